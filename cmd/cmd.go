@@ -9,3 +9,7 @@ import (
 func AddCommand(command *cobra.Command) error {
 	return icmd.AddCommand(command)
 }
+
+func AddCacheCommand(command *cobra.Command) error {
+	return icmd.AddCacheCommand(command)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage caches shared between dpl projects",
+	}
+)
+
+func AddCacheCommand(command *cobra.Command) error {
+	cacheCmd.AddCommand(command)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+}
@@ -8,13 +8,22 @@ import (
 	"github.com/dev-pipeline/dpl-go/internal/common"
 )
 
+// AddSelectionArgs adds the flags that decide which components a command
+// works on.  Commands that don't run tasks use it instead of AddCommonArgs.
+func AddSelectionArgs(command *cobra.Command, args *common.Args) {
+	command.PersistentFlags().StringVar(&args.Dependencies, "dependencies", "deep",
+		"Method of resolving dependencies")
+}
+
 func AddCommonArgs(command *cobra.Command, args *common.Args) {
 	command.PersistentFlags().BoolVar(&args.KeepGoing, "keep-going", false,
 		"Continue performing work even if a task fails")
 	// command.PersistentFlags().StringVar(&args.Executor, "executor", "",
 	// 	"Method of executing work")
-	command.PersistentFlags().StringVar(&args.Dependencies, "dependencies", "deep",
-		"Method of resolving dependencies")
+	AddSelectionArgs(command, args)
 	command.PersistentFlags().IntVar(&args.MaxTasks, "max-tasks", runtime.NumCPU(),
 		"Maximum number of tasks to execute at once")
+	command.PersistentFlags().StringVar(&args.Shuffle, "shuffle", "",
+		"Run tasks in a random order from this seed, to shake out missing dependencies (a seed is picked if none is given)")
+	command.PersistentFlags().Lookup("shuffle").NoOptDefVal = common.ShuffleRandom
 }
@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
 )
 
 var (
@@ -12,6 +14,8 @@ var (
 		Use:   "dpl",
 		Short: "Chain commands together to build projects",
 	}
+
+	offline bool
 )
 
 func Execute() {
@@ -25,3 +29,14 @@ func AddCommand(command *cobra.Command) error {
 	rootCmd.AddCommand(command)
 	return nil
 }
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false,
+		fmt.Sprintf("Don't access the network (same as setting %v=1)", dpl.OfflineEnv))
+	cobra.OnInitialize(func() {
+		if offline {
+			// through the environment, so builds and foreach commands see it
+			os.Setenv(dpl.OfflineEnv, "1")
+		}
+	})
+}
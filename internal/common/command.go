@@ -3,18 +3,55 @@ package common
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl"
 	"github.com/dev-pipeline/dpl-go/pkg/dpl/resolve"
 )
 
+const (
+	// ShuffleRandom asks for a shuffle with a seed picked at random.
+	ShuffleRandom string = "random"
+
+	// commands that don't run tasks of their own borrow build's
+	// dependencies to decide which components --dependencies pulls in
+	dependencyTask string = "build"
+
+	// only builds are timed; other tasks (e.g., checkouts) are mostly
+	// waiting on the network, so their durations say little about the next
+	// run
+	timedTask string = "build"
+)
+
 type Args struct {
 	KeepGoing    bool
 	Executor     string
 	Dependencies string
 	MaxTasks     int
+	// Shuffle is a seed for randomizing the order tasks run in, ShuffleRandom,
+	// or empty to use the usual order.
+	Shuffle string
+}
+
+// shuffleSeed works out which seed to shuffle with, or nil if tasks
+// shouldn't be shuffled.
+func shuffleSeed(shuffle string) (*int64, error) {
+	if len(shuffle) == 0 {
+		return nil, nil
+	}
+	if shuffle == ShuffleRandom {
+		seed := time.Now().UnixNano()
+		return &seed, nil
+	}
+	seed, err := strconv.ParseInt(shuffle, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shuffle seed '%v'", shuffle)
+	}
+	return &seed, nil
 }
 
 type TaskFn func(dpl.Component) error
@@ -35,18 +72,61 @@ type taskComplete struct {
 	err  error
 }
 
-func executeTasks(taskChannel chan work, doneChannel chan taskComplete) {
+type taskCompleteFn func(taskComplete)
+
+// batchResolver hands out the batches from a resolver without Next one task
+// at a time, so every resolver can run through executeTasks.
+type batchResolver struct {
+	resolve.Resolver
+	m       sync.Mutex
+	batches chan []string
+	pending []string
+}
+
+func newBatchResolver(resolver resolve.Resolver) *batchResolver {
+	br := &batchResolver{
+		Resolver: resolver,
+		batches:  make(chan []string),
+	}
+	resolver.Resolve(br.batches)
+	return br
+}
+
+func (br *batchResolver) Next() (string, bool) {
+	br.m.Lock()
+	defer br.m.Unlock()
+	for len(br.pending) == 0 {
+		batch, ok := <-br.batches
+		if !ok {
+			return "", false
+		}
+		br.pending = batch
+	}
+	task := br.pending[0]
+	br.pending = br.pending[1:]
+	return task, true
+}
+
+func (br *batchResolver) Shuffle(int64) {
+	log.Printf("This resolver can't shuffle tasks; running them in the usual order")
+}
+
+// executeTasks runs tasks until the resolver runs out.  Completion is
+// reported before asking for the next task, so anything it unblocked is
+// considered when picking what's most critical.
+func executeTasks(project dpl.Project, resolver resolve.SchedulingResolver, taskMap map[string]TaskFn, completeFn taskCompleteFn) {
 	for {
-		workUnit, ok := <-taskChannel
+		task, ok := resolver.Next()
 		if !ok {
 			return
 		}
+		workUnit := makeWork(project, task, taskMap)
 		log.Printf("Executing %v", workUnit.name)
 		err := workUnit.fn(workUnit.component)
-		doneChannel <- taskComplete{
+		completeFn(taskComplete{
 			name: workUnit.name,
 			err:  err,
-		}
+		})
 	}
 }
 
@@ -62,53 +142,24 @@ func makeTaskContainers(tasks []Task) ([]string, map[string]TaskFn) {
 	return taskList, taskMap
 }
 
-type taskCompleteFn func(taskComplete)
-
-func startDrainComplete(doneChannel chan taskComplete, completeFn taskCompleteFn) {
-	go func() {
-		for {
-			completedTask, ok := <-doneChannel
-			if !ok {
-				return
-			}
-			completeFn(completedTask)
-		}
-	}()
-}
-
-func startResolve(project dpl.Project, resolver resolve.Resolver, taskMap map[string]TaskFn) chan work {
-	workChannel := make(chan work)
-	go func() {
-		defer close(workChannel)
-
-		readyTaskChannel := make(chan []string)
-		resolver.Resolve(readyTaskChannel)
-		readyTasks := <-readyTaskChannel
-		for readyTasks != nil {
-			for _, taskToExecute := range readyTasks {
-				taskChunks := strings.Split(taskToExecute, ".")
-				if len(taskChunks) != 2 {
-					log.Fatalf("Internal error: improper extraction of task '%v'", taskChunks)
-				}
-				component, err := project.GetComponent(taskChunks[0])
-				if err != nil {
-					log.Fatalf("Internal error: cannot get component %v (%v)", taskChunks[0], err)
-				}
-				workFn, found := taskMap[taskChunks[1]]
-				if !found {
-					log.Fatalf("Internal error: no handler for task %v", taskChunks[1])
-				}
-
-				workChannel <- work{
-					fn:        workFn,
-					name:      taskToExecute,
-					component: component,
-				}
-			}
-			readyTasks = <-readyTaskChannel
-		}
-	}()
-	return workChannel
+func makeWork(project dpl.Project, taskToExecute string, taskMap map[string]TaskFn) work {
+	taskChunks := strings.Split(taskToExecute, ".")
+	if len(taskChunks) != 2 {
+		log.Fatalf("Internal error: improper extraction of task '%v'", taskChunks)
+	}
+	component, err := project.GetComponent(taskChunks[0])
+	if err != nil {
+		log.Fatalf("Internal error: cannot get component %v (%v)", taskChunks[0], err)
+	}
+	workFn, found := taskMap[taskChunks[1]]
+	if !found {
+		log.Fatalf("Internal error: no handler for task %v", taskChunks[1])
+	}
+	return work{
+		fn:        workFn,
+		name:      taskToExecute,
+		component: component,
+	}
 }
 
 type failedTask struct {
@@ -121,24 +172,19 @@ func (ft *failedTask) Error() string {
 	return ""
 }
 
-func runTasks(project dpl.Project, components []string, tasks []Task, resolveFn resolve.ResolveFn, keepGoing bool, maxTasks int) error {
+func runTasks(project dpl.Project, components []string, tasks []Task, resolveFn resolve.ResolveFn, keepGoing bool, maxTasks int, seed *int64) error {
 	taskList, taskMap := makeTaskContainers(tasks)
-	resolver, err := resolveFn(project, components, taskList)
+	baseResolver, err := resolveFn(project, components, taskList)
 	if err != nil {
 		return err
 	}
-
-	workChannel := startResolve(project, resolver, taskMap)
-	doneChannel := make(chan taskComplete)
-	defer close(doneChannel)
-	wg := sync.WaitGroup{}
-
-	for i := 0; i < maxTasks; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			executeTasks(workChannel, doneChannel)
-		}()
+	resolver, ok := baseResolver.(resolve.SchedulingResolver)
+	if !ok {
+		resolver = newBatchResolver(baseResolver)
+	}
+	if seed != nil {
+		log.Printf("Shuffling tasks with seed %v (use --shuffle=%v to repeat)", *seed, *seed)
+		resolver.Shuffle(*seed)
 	}
 
 	errors := []error{}
@@ -163,8 +209,15 @@ func runTasks(project dpl.Project, components []string, tasks []Task, resolveFn
 			})
 		}
 	}
-	startDrainComplete(doneChannel, completeTask)
 
+	wg := sync.WaitGroup{}
+	for i := 0; i < maxTasks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executeTasks(project, resolver, taskMap, completeTask)
+		}()
+	}
 	wg.Wait()
 
 	m.Lock()
@@ -176,20 +229,91 @@ func runTasks(project dpl.Project, components []string, tasks []Task, resolveFn
 	return errors[0]
 }
 
-func DoCommand(components []string, args Args, tasks []Task) error {
-	project, err := dpl.LoadProject()
+// SelectComponents picks the components the build task would touch for
+// targets, in sorted order.
+func SelectComponents(project dpl.Project, targets []string, dependencies string) ([]string, error) {
+	graph, err := resolve.MakeGraph(dependencies, project, targets, []string{dependencyTask})
 	if err != nil {
-		return fmt.Errorf("failed to load project: %v", err)
+		return nil, err
+	}
+	components := []string{}
+	for _, node := range graph.Nodes {
+		component, _, _ := strings.Cut(node, ".")
+		components = append(components, component)
 	}
+	sort.Strings(components)
+	return components, nil
+}
 
+// LoadComponents loads the project and picks the components a command that
+// doesn't run tasks works on.  Like DoCommand, no components means all of
+// them.
+func LoadComponents(components []string, args Args) (dpl.Project, []string, error) {
+	project, err := dpl.LoadProject()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load project: %v", err)
+	}
 	if len(components) == 0 {
 		components = project.ComponentNames()
 	}
+	components, err = SelectComponents(project, components, args.Dependencies)
+	if err != nil {
+		return nil, nil, err
+	}
+	return project, components, nil
+}
+
+// timeTasks wraps the build task so how long each successful build took is
+// recorded, letting the next run start long chains of work early.
+func timeTasks(tasks []Task) []Task {
+	timed := []Task{}
+	for _, task := range tasks {
+		if task.Name != timedTask {
+			timed = append(timed, task)
+			continue
+		}
+		name := task.Name
+		work := task.Work
+		timed = append(timed, Task{
+			Name: name,
+			Work: func(component dpl.Component) error {
+				start := time.Now()
+				err := work(component)
+				if err == nil {
+					resolve.RecordDuration(component, name, time.Since(start))
+				}
+				return err
+			},
+		})
+	}
+	return timed
+}
+
+// RunTasks runs tasks for components without saving anything back to the
+// project.  Commands that only look at the project (e.g., foreach) use it
+// instead of DoCommand.
+func RunTasks(project dpl.Project, components []string, args Args, tasks []Task) error {
 	resolveFn := resolve.GetResolver(args.Dependencies)
 	if resolveFn == nil {
 		return fmt.Errorf("no resolver '%v'", args.Dependencies)
 	}
-	err = runTasks(project, components, tasks, resolveFn, args.KeepGoing, args.MaxTasks)
+	seed, err := shuffleSeed(args.Shuffle)
+	if err != nil {
+		return err
+	}
+	return runTasks(project, components, tasks, resolveFn, args.KeepGoing, args.MaxTasks, seed)
+}
+
+func DoCommand(components []string, args Args, tasks []Task) error {
+	project, err := dpl.LoadProject()
+	if err != nil {
+		return fmt.Errorf("failed to load project: %v", err)
+	}
+
+	if len(components) == 0 {
+		components = project.ComponentNames()
+	}
+	err = RunTasks(project, components, args, timeTasks(tasks))
 	project.Write()
 	return err
 }
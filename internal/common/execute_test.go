@@ -2,6 +2,10 @@ package common
 
 import (
 	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -68,7 +72,7 @@ func TestCleanRun(t *testing.T) {
 		},
 	}
 
-	err := runTasks(diamondProject, []string{"foo", "bar", "baz", "biz"}, tasks, resolveFn, false, 1)
+	err := runTasks(diamondProject, []string{"foo", "bar", "baz", "biz"}, tasks, resolveFn, false, 1, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -77,6 +81,51 @@ func TestCleanRun(t *testing.T) {
 	}
 }
 
+// batchOnly hides everything but the original Resolver methods, like a
+// resolver written before Next existed.
+type batchOnly struct {
+	resolve.Resolver
+}
+
+func TestBatchResolverRun(t *testing.T) {
+	order := []string{}
+	resolveFn := func(project dpl.Project, targets []string, tasks []string) (resolve.Resolver, error) {
+		resolver, err := resolve.GetResolver("deep")(project, targets, tasks)
+		return batchOnly{resolver}, err
+	}
+	tasks := []Task{
+		{
+			Name: "build",
+			Work: func(component dpl.Component) error {
+				order = append(order, component.Name())
+				return nil
+			},
+		},
+	}
+
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": testcommon.ResolveComponent{ComponentName: "foo"},
+			"bar": testcommon.ResolveComponent{
+				ComponentName: "bar",
+				Data: map[string][]string{
+					"depends.build": {"foo"},
+				},
+			},
+		},
+	}
+
+	// shuffling isn't possible, so it's ignored
+	seed := int64(1)
+	err := runTasks(project, []string{"bar"}, tasks, resolveFn, false, 1, &seed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"foo", "bar"}) {
+		t.Fatalf("Unexpected order: %v", order)
+	}
+}
+
 func TestErrorRun(t *testing.T) {
 	executeCount := 0
 	resolveFn := resolve.GetResolver("deep")
@@ -90,7 +139,7 @@ func TestErrorRun(t *testing.T) {
 		},
 	}
 
-	err := runTasks(diamondProject, []string{"foo", "bar", "baz", "biz"}, tasks, resolveFn, false, 1)
+	err := runTasks(diamondProject, []string{"foo", "bar", "baz", "biz"}, tasks, resolveFn, false, 1, nil)
 	if err == nil {
 		t.Fatalf("Missing expected error")
 	}
@@ -116,7 +165,7 @@ func TestRecoverError(t *testing.T) {
 		},
 	}
 
-	err := runTasks(parallelProject, []string{"foo", "bar", "baz", "biz"}, tasks, resolveFn, true, 4)
+	err := runTasks(parallelProject, []string{"foo", "bar", "baz", "biz"}, tasks, resolveFn, true, 4, nil)
 	if err == nil {
 		t.Fatalf("Missing expected error")
 	}
@@ -124,3 +173,150 @@ func TestRecoverError(t *testing.T) {
 		t.Fatalf("Executed too many tasks (%v)", executeCount.Load())
 	}
 }
+
+func TestCriticalPathFirst(t *testing.T) {
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"alone":  testcommon.ResolveComponent{ComponentName: "alone"},
+			"chain1": testcommon.ResolveComponent{ComponentName: "chain1"},
+			"chain2": testcommon.ResolveComponent{
+				ComponentName: "chain2",
+				Data: map[string][]string{
+					"depends.build": {"chain1"},
+				},
+			},
+			"chain3": testcommon.ResolveComponent{
+				ComponentName: "chain3",
+				Data: map[string][]string{
+					"depends.build": {"chain2"},
+				},
+			},
+		},
+	}
+	order := []string{}
+	tasks := []Task{
+		{
+			Name: "build",
+			Work: func(component dpl.Component) error {
+				order = append(order, component.Name())
+				return nil
+			},
+		},
+	}
+
+	err := runTasks(project, project.ComponentNames(), tasks, resolve.GetResolver("deep"), false, 1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// by the time chain3 is ready, it's no more critical than alone
+	expected := []string{"chain1", "chain2", "alone", "chain3"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Unexpected order: %v", order)
+	}
+}
+
+func TestRunTasksLeavesProject(t *testing.T) {
+	data := map[string][]string{}
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": testcommon.ResolveComponent{ComponentName: "foo", Data: data},
+		},
+	}
+	tasks := []Task{
+		{
+			Name: "foreach",
+			Work: func(dpl.Component) error {
+				return nil
+			},
+		},
+	}
+
+	err := RunTasks(project, []string{"foo"}, Args{Dependencies: "deep", MaxTasks: 1}, tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("Unexpected values recorded: %v", data)
+	}
+}
+
+func TestTimeTasksBuildOnly(t *testing.T) {
+	buildDir := t.TempDir()
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": testcommon.ResolveComponent{ComponentName: "foo", WorkDir: path.Join(buildDir, "foo")},
+		},
+	}
+	noop := func(dpl.Component) error {
+		return nil
+	}
+	tasks := timeTasks([]Task{
+		{Name: "checkout", Work: noop},
+		{Name: "build", Work: noop},
+	})
+
+	err := RunTasks(project, []string{"foo"}, Args{Dependencies: "deep", MaxTasks: 1}, tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, err := os.ReadFile(path.Join(buildDir, ".dpl", "durations"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "foo.build ") {
+		t.Fatalf("Unexpected durations: %v", string(contents))
+	}
+}
+
+func TestShuffleSeed(t *testing.T) {
+	seed, err := shuffleSeed("")
+	if err != nil || seed != nil {
+		t.Fatalf("Unexpected seed: %v (%v)", seed, err)
+	}
+	seed, err = shuffleSeed("42")
+	if err != nil || seed == nil || *seed != 42 {
+		t.Fatalf("Unexpected seed: %v (%v)", seed, err)
+	}
+	seed, err = shuffleSeed(ShuffleRandom)
+	if err != nil || seed == nil {
+		t.Fatalf("Unexpected seed: %v (%v)", seed, err)
+	}
+	_, err = shuffleSeed("lots")
+	if err == nil {
+		t.Fatalf("Missing expected error")
+	}
+}
+
+func TestSelectComponents(t *testing.T) {
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": testcommon.ResolveComponent{ComponentName: "foo"},
+			"bar": testcommon.ResolveComponent{
+				ComponentName: "bar",
+				Data: map[string][]string{
+					"depends.build": {"foo"},
+				},
+			},
+			"baz": testcommon.ResolveComponent{ComponentName: "baz"},
+		},
+	}
+	tests := []struct {
+		dependencies string
+		targets      []string
+		expected     []string
+	}{
+		{"deep", []string{"bar"}, []string{"bar", "foo"}},
+		{"reverse", []string{"foo"}, []string{"bar", "foo"}},
+		{"deep", []string{"foo"}, []string{"foo"}},
+	}
+	for _, test := range tests {
+		components, err := SelectComponents(project, test.targets, test.dependencies)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(components, test.expected) {
+			t.Fatalf("Unexpected components for %v %v (%v vs %v)", test.dependencies, test.targets, components, test.expected)
+		}
+	}
+}
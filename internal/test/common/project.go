@@ -11,11 +11,14 @@ var (
 )
 
 type ResolveComponent struct {
-	Data map[string][]string
+	ComponentName string
+	Data          map[string][]string
+	SourceDir     string
+	WorkDir       string
 }
 
 func (rs *ResolveComponent) Name() string {
-	return ""
+	return rs.ComponentName
 }
 
 func (rs *ResolveComponent) KeyNames() []string {
@@ -34,18 +37,23 @@ func (rs *ResolveComponent) ExpandValues(key string) ([]string, error) {
 	return rs.GetValues(key), nil
 }
 
-func (rs *ResolveComponent) SetValues(string, []string) {
+func (rs *ResolveComponent) SetValues(key string, values []string) {
+	if rs.Data == nil {
+		rs.Data = map[string][]string{}
+	}
+	rs.Data[key] = values
 }
 
-func (rs *ResolveComponent) EraseKey(string) {
+func (rs *ResolveComponent) EraseKey(key string) {
+	delete(rs.Data, key)
 }
 
 func (rs *ResolveComponent) GetSourceDir() string {
-	return ""
+	return rs.SourceDir
 }
 
 func (rs *ResolveComponent) GetWorkDir() string {
-	return ""
+	return rs.WorkDir
 }
 
 type ResolveComponents map[string]ResolveComponent
@@ -46,6 +46,11 @@ var (
 
 type BuildConfig struct {
 	Env []string
+
+	// Offline means the build shouldn't touch the network.  Builders wrapping
+	// tools that download dependencies should pass along their own offline
+	// switch (e.g., cargo --offline, GOFLAGS=-mod=vendor, pip --no-index).
+	Offline bool
 }
 
 type Builder interface {
@@ -118,7 +123,8 @@ func doFullBuild(component dpl.Component) error {
 		return err
 	}
 	config := BuildConfig{
-		Env: os.Environ(),
+		Env:     os.Environ(),
+		Offline: dpl.Offline(),
 	}
 	for k, v := range envChanges.prependValues {
 		config.Env = prependEnvironment(config.Env, k, v)
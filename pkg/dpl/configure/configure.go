@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/lockfile"
 )
 
 type ConfigureFlags struct {
@@ -118,6 +119,7 @@ func configureFromScratch(flags ConfigureFlags) (*IniProject, error) {
 	}
 	controlData.fields[sourceDirKey] = []string{sourceDirAbsPath}
 	controlData.fields[workDirKey] = []string{workDirAbsPath}
+	lockFile := path.Join(path.Dir(sourceFileAbsPath), lockfile.Filename)
 
 	components := project.ComponentNames()
 	for i := range components {
@@ -138,8 +140,14 @@ func configureFromScratch(flags ConfigureFlags) (*IniProject, error) {
 			}
 		}
 		component.SetValues(sourceDirKey, []string{sourceDir})
+		component.SetValues(configDirKey, []string{path.Dir(sourceFileAbsPath)})
+		component.SetValues(lockFileKey, []string{lockFile})
 		component.SetValues(workDirKey, []string{path.Join(workDirAbsPath, component.Name())})
 	}
+	err = checkLockFile(project, lockFile)
+	if err != nil {
+		return nil, err
+	}
 	err = applyControlData(project, controlData)
 	if err != nil {
 		return nil, err
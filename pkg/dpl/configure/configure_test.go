@@ -2,6 +2,8 @@ package configure
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl"
@@ -37,3 +39,35 @@ func TestRestrictedName(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+func TestConfigDirWithRootDir(t *testing.T) {
+	configDir := t.TempDir()
+	rootDir := t.TempDir()
+	configFile := path.Join(configDir, "build.config")
+	err := os.WriteFile(configFile, []byte("[dpl.control]\n[foo]\n"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	project, err := configureFromScratch(ConfigureFlags{
+		BuildDir:   t.TempDir(),
+		ConfigFile: configFile,
+		RootDir:    rootDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	component, err := project.GetComponent("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		configDirKey: configDir,
+		sourceDirKey: path.Join(rootDir, "foo"),
+	}
+	for key, value := range expected {
+		if actual := component.GetValues(key); len(actual) != 1 || actual[0] != value {
+			t.Fatalf("Unexpected %v: %v", key, actual)
+		}
+	}
+}
@@ -24,6 +24,9 @@ const (
 	// these are put in each component, so prefix them with dpl
 	sourceDirKey string = "dpl.source_dir"
 	workDirKey   string = "dpl.work_dir"
+	// where build.config is, which --root-dir doesn't change
+	configDirKey string = "dpl.config_dir"
+	lockFileKey  string = "dpl.lock_file"
 )
 
 type controlData struct {
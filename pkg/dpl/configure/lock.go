@@ -0,0 +1,56 @@
+package configure
+
+import (
+	"log"
+	"sort"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/lockfile"
+)
+
+const (
+	// the lock file records the scm.uri values it was made from
+	lockedUriKey string = "scm.uri"
+)
+
+// staleLockEntries finds components whose lock entries no longer match the
+// configuration, or that aren't locked at all.
+func staleLockEntries(project *IniProject, lock lockfile.LockFile) ([]string, error) {
+	stale := []string{}
+	for _, name := range project.ComponentNames() {
+		component, err := project.getConfigComponent(name)
+		if err != nil {
+			return nil, err
+		}
+		uris, err := component.ExpandValues(lockedUriKey)
+		if err != nil {
+			return nil, err
+		}
+		entry, found := lock[name]
+		if len(uris) == 0 && !found {
+			continue
+		}
+		if !found || !entry.Matches(uris) {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// checkLockFile warns when a lock file exists but doesn't match the project.
+// It's only a warning, since updating the lock file needs a configured
+// project.
+func checkLockFile(project *IniProject, lockFile string) error {
+	lock, err := lockfile.Load(lockFile)
+	if err != nil || len(lock) == 0 {
+		return err
+	}
+	stale, err := staleLockEntries(project, lock)
+	if err != nil {
+		return err
+	}
+	for _, name := range stale {
+		log.Printf("Warning: %v is out of date for %v (run 'dpl lock --update %v')", lockFile, name, name)
+	}
+	return nil
+}
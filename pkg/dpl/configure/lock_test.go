@@ -0,0 +1,37 @@
+package configure
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/lockfile"
+)
+
+func TestStaleLockEntries(t *testing.T) {
+	project, err := loadRawConfig([]byte(`
+[foo]
+scm.uri = git://example.com/foo;ref=main
+
+[bar]
+scm.uri = git://example.com/bar;ref=next
+
+[baz]
+scm.uri = git://example.com/baz
+
+[no-scm]
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lock := lockfile.LockFile{
+		"foo": {URIs: []string{"git://example.com/foo;ref=main"}},
+		"bar": {URIs: []string{"git://example.com/bar;ref=main"}},
+	}
+	stale, err := staleLockEntries(project, lock)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(stale, []string{"bar", "baz"}) {
+		t.Fatalf("Unexpected stale entries: %v", stale)
+	}
+}
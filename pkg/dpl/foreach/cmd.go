@@ -0,0 +1,71 @@
+package foreach
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+	icmd "github.com/dev-pipeline/dpl-go/internal/cmd"
+	"github.com/dev-pipeline/dpl-go/internal/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type foreachFlags struct {
+	In       string
+	Parallel int
+}
+
+var (
+	foreachCommon common.Args
+	foreachArgs   foreachFlags
+
+	foreachCmd = &cobra.Command{
+		Use:   "foreach [components] -- command [args]",
+		Short: "Run a command in each component's source or work directory",
+		Long: `Run a command in each component's source or work directory.
+
+Arguments may use ${key} to refer to a component's configuration; for example,
+${dpl.work_dir} or ${build.install_path}.  Use \${...} to pass a literal ${...}
+through to the command.`,
+		RunE: doForeach,
+	}
+)
+
+func doForeach(command *cobra.Command, args []string) error {
+	dash := command.ArgsLenAtDash()
+	if dash < 0 || dash == len(args) {
+		return fmt.Errorf("missing command (put it after --)")
+	}
+	toRun := args[dash:]
+	project, components, err := common.LoadComponents(args[:dash], foreachCommon)
+	if err != nil {
+		return err
+	}
+	if !command.Flags().Changed("max-tasks") {
+		foreachCommon.MaxTasks = foreachArgs.Parallel
+	}
+	// nothing is saved, so a read-only command leaves the project alone
+	return common.RunTasks(project, components, foreachCommon, []common.Task{
+		{
+			Name: "foreach",
+			Work: func(component dpl.Component) error {
+				return runCommand(component, toRun, foreachArgs.In, os.Stdout, os.Stderr)
+			},
+		},
+	})
+}
+
+func init() {
+	icmd.AddCommonArgs(foreachCmd, &foreachCommon)
+	// one at a time by default, so output from different components doesn't
+	// interleave
+	foreachCmd.PersistentFlags().IntVar(&foreachArgs.Parallel, "parallel", 1,
+		"Number of commands to run at once")
+	foreachCmd.PersistentFlags().MarkHidden("max-tasks")
+	foreachCmd.MarkFlagsMutuallyExclusive("parallel", "max-tasks")
+	foreachCmd.Flags().StringVar(&foreachArgs.In, "in", inSource,
+		"Directory to run the command in (source or work)")
+	cmd.AddCommand(foreachCmd)
+}
@@ -0,0 +1,174 @@
+package foreach
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	inSource string = "source"
+	inWork   string = "work"
+)
+
+var (
+	// like configuration values, \${...} is left alone
+	placeholderPattern *regexp.Regexp = regexp.MustCompile(`(\\?)\${([a-zA-Z0-9_.\-]+)}`)
+
+	// output from parallel commands is interleaved a line at a time
+	outputLock sync.Mutex
+)
+
+type missingKeyError struct {
+	component string
+	key       string
+}
+
+func (mke *missingKeyError) Error() string {
+	return fmt.Sprintf("%v has no value for '%v'", mke.component, mke.key)
+}
+
+func lookupKey(component dpl.Component, key string) ([]string, error) {
+	values, err := component.ExpandValues(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, &missingKeyError{
+			component: component.Name(),
+			key:       key,
+		}
+	}
+	return values, nil
+}
+
+// expandCommand fills in ${key} placeholders from component.  An argument
+// that's nothing but a placeholder becomes one argument per value; anywhere
+// else, multiple values are joined with spaces.
+func expandCommand(component dpl.Component, command []string) ([]string, error) {
+	ret := []string{}
+	for _, arg := range command {
+		if groups := placeholderPattern.FindStringSubmatch(arg); groups != nil && groups[0] == arg && len(groups[1]) == 0 {
+			values, err := lookupKey(component, groups[2])
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, values...)
+			continue
+		}
+		var err error
+		expanded := placeholderPattern.ReplaceAllStringFunc(arg, func(match string) string {
+			if err != nil {
+				return match
+			}
+			groups := placeholderPattern.FindStringSubmatch(match)
+			if len(groups[1]) > 0 {
+				return match[1:]
+			}
+			var values []string
+			values, err = lookupKey(component, groups[2])
+			return strings.Join(values, " ")
+		})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, expanded)
+	}
+	return ret, nil
+}
+
+// prefixWriter writes whole lines to out, each starting with prefix.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	buffer []byte
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	_, err := fmt.Fprintf(pw.out, "%v%s\n", pw.prefix, line)
+	return err
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buffer = append(pw.buffer, p...)
+	for {
+		index := bytes.IndexByte(pw.buffer, '\n')
+		if index < 0 {
+			return len(p), nil
+		}
+		err := pw.writeLine(pw.buffer[:index])
+		pw.buffer = pw.buffer[index+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Flush writes out a final line that didn't end with a newline.
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buffer) == 0 {
+		return nil
+	}
+	err := pw.writeLine(pw.buffer)
+	pw.buffer = nil
+	return err
+}
+
+func getDir(component dpl.Component, in string) (string, error) {
+	var dir string
+	switch in {
+	case inSource:
+		dir = component.GetSourceDir()
+	case inWork:
+		dir = component.GetWorkDir()
+	default:
+		return "", fmt.Errorf("invalid directory '%v' (expected %v or %v)", in, inSource, inWork)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%v isn't a directory", dir)
+	}
+	return dir, nil
+}
+
+// runCommand runs command in one of component's directories, prefixing its
+// output with the component's name.
+func runCommand(component dpl.Component, command []string, in string, stdout io.Writer, stderr io.Writer) error {
+	dir, err := getDir(component, in)
+	if err != nil {
+		return err
+	}
+	expanded, err := expandCommand(component, command)
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("%v: ", component.Name())
+	outWriter := &prefixWriter{prefix: prefix, out: stdout}
+	errWriter := &prefixWriter{prefix: prefix, out: stderr}
+	cmd := exec.Command(expanded[0], expanded[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), fmt.Sprintf("DPL_COMPONENT=%v", component.Name()))
+	cmd.Stdout = outWriter
+	cmd.Stderr = errWriter
+	runErr := cmd.Run()
+	err = outWriter.Flush()
+	if err == nil {
+		err = errWriter.Flush()
+	}
+	if runErr != nil {
+		return fmt.Errorf("%v failed: %w", strings.Join(expanded, " "), runErr)
+	}
+	return err
+}
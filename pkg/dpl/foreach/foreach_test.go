@@ -0,0 +1,90 @@
+package foreach
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func makeComponent(t *testing.T) *testcommon.ResolveComponent {
+	return &testcommon.ResolveComponent{
+		ComponentName: "foo",
+		SourceDir:     t.TempDir(),
+		WorkDir:       t.TempDir(),
+		Data: map[string][]string{
+			"build.flags": {"-O2", "-g"},
+			"name":        {"foo"},
+		},
+	}
+}
+
+func TestExpandCommand(t *testing.T) {
+	component := makeComponent(t)
+	expanded, err := expandCommand(component, []string{"cc", "${build.flags}", "-o", "${name}.o", "--flags=${build.flags}", "\\${HOME}"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"cc", "-O2", "-g", "-o", "foo.o", "--flags=-O2 -g", "${HOME}"}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Fatalf("Unexpected command: %v", expanded)
+	}
+}
+
+func TestExpandCommandMissing(t *testing.T) {
+	component := makeComponent(t)
+	_, err := expandCommand(component, []string{"echo", "x${missing}"})
+	if _, ok := err.(*missingKeyError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	writer := &prefixWriter{prefix: "foo: ", out: out}
+	for _, chunk := range []string{"one\ntw", "o\n", "three"} {
+		_, err := writer.Write([]byte(chunk))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	err := writer.Flush()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.String() != "foo: one\nfoo: two\nfoo: three\n" {
+		t.Fatalf("Unexpected output: %q", out.String())
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	component := makeComponent(t)
+	for _, in := range []string{inSource, inWork} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		err := runCommand(component, []string{"sh", "-c", "pwd; echo $DPL_COMPONENT ${name} >&2"}, in, stdout, stderr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dir := component.SourceDir
+		if in == inWork {
+			dir = component.WorkDir
+		}
+		if stdout.String() != "foo: "+dir+"\n" || stderr.String() != "foo: foo foo\n" {
+			t.Fatalf("Unexpected output: %q %q", stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestRunCommandFails(t *testing.T) {
+	component := makeComponent(t)
+	err := runCommand(component, []string{"false"}, inSource, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	err = runCommand(component, []string{"true"}, "elsewhere", &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
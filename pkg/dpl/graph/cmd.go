@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/resolve"
+)
+
+type graphFlags struct {
+	Tasks        []string
+	Format       string
+	Dependencies string
+	Path         []string
+}
+
+var (
+	graphArgs graphFlags
+
+	graphCmd = &cobra.Command{
+		Use:   "graph [components]",
+		Short: "Print the graph of tasks dpl would schedule",
+		Long: `Print the graph of tasks dpl would schedule.
+
+Nodes are component.task pairs, and each edge points from a task to one that
+has to wait for it.  Use --path to highlight how two components are connected.`,
+		RunE: doGraph,
+	}
+)
+
+func doGraph(command *cobra.Command, components []string) error {
+	if len(graphArgs.Path) != 0 && len(graphArgs.Path) != 2 {
+		return fmt.Errorf("--path needs exactly two components")
+	}
+	if _, found := graphWriters[graphArgs.Format]; !found {
+		return &unknownFormatError{
+			format: graphArgs.Format,
+		}
+	}
+	project, err := dpl.LoadProject()
+	if err != nil {
+		return fmt.Errorf("failed to load project: %v", err)
+	}
+	if len(components) == 0 {
+		components = project.ComponentNames()
+	}
+	graph, err := resolve.MakeGraph(graphArgs.Dependencies, project, components, graphArgs.Tasks)
+	if err != nil {
+		return err
+	}
+	h := highlight{}
+	if len(graphArgs.Path) == 2 {
+		h, err = findPath(graph, graphArgs.Path[0], graphArgs.Path[1])
+		if err != nil {
+			return err
+		}
+	}
+	return writeGraph(os.Stdout, graphArgs.Format, graph, h)
+}
+
+func init() {
+	graphCmd.Flags().StringSliceVar(&graphArgs.Tasks, "tasks", []string{"scm", "build"},
+		"Tasks to include, in the order they run")
+	graphCmd.Flags().StringVar(&graphArgs.Format, "format", formatDot,
+		"Output format (dot, json, or mermaid)")
+	graphCmd.Flags().StringVar(&graphArgs.Dependencies, "dependencies", "deep",
+		"Method of resolving dependencies")
+	graphCmd.Flags().StringSliceVar(&graphArgs.Path, "path", nil,
+		"Highlight a dependency path between two components (e.g., --path app,zlib)")
+	cmd.AddCommand(graphCmd)
+}
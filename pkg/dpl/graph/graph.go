@@ -0,0 +1,201 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/resolve"
+)
+
+const (
+	formatDot     string = "dot"
+	formatJSON    string = "json"
+	formatMermaid string = "mermaid"
+)
+
+type unknownFormatError struct {
+	format string
+}
+
+func (ufe *unknownFormatError) Error() string {
+	return fmt.Sprintf("unknown graph format '%v' (expected %v, %v, or %v)", ufe.format, formatDot, formatJSON, formatMermaid)
+}
+
+type noPathError struct {
+	from string
+	to   string
+}
+
+func (npe *noPathError) Error() string {
+	return fmt.Sprintf("no dependency path between %v and %v", npe.from, npe.to)
+}
+
+type graphWriter func(io.Writer, *resolve.Graph, highlight) error
+
+var (
+	graphWriters = map[string]graphWriter{
+		formatDot:     writeDot,
+		formatJSON:    writeJSON,
+		formatMermaid: writeMermaid,
+	}
+)
+
+// highlight is the set of nodes and edges along a path that should stand out.
+type highlight struct {
+	path  []string
+	nodes map[string]struct{}
+	edges map[resolve.Edge]struct{}
+}
+
+func (h highlight) hasNode(node string) bool {
+	_, found := h.nodes[node]
+	return found
+}
+
+func (h highlight) hasEdge(edge resolve.Edge) bool {
+	_, found := h.edges[edge]
+	return found
+}
+
+func taskComponent(task string) string {
+	component, _, _ := strings.Cut(task, ".")
+	return component
+}
+
+// findTaskPath does a breadth-first search along edges from any of from's
+// tasks to any of to's, so the path found is a shortest one.
+func findTaskPath(graph *resolve.Graph, from string, to string) []string {
+	next := map[string][]string{}
+	for _, edge := range graph.Edges {
+		next[edge.From] = append(next[edge.From], edge.To)
+	}
+	previous := map[string]string{}
+	queue := []string{}
+	for _, node := range graph.Nodes {
+		if taskComponent(node) == from {
+			previous[node] = ""
+			queue = append(queue, node)
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if taskComponent(node) == to {
+			path := []string{}
+			for ; node != ""; node = previous[node] {
+				path = append([]string{node}, path...)
+			}
+			return path
+		}
+		for _, dependent := range next[node] {
+			if _, seen := previous[dependent]; !seen {
+				previous[dependent] = node
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return nil
+}
+
+// findPath highlights a chain of dependencies between two components, in
+// whichever direction one exists.
+func findPath(graph *resolve.Graph, from string, to string) (highlight, error) {
+	path := findTaskPath(graph, from, to)
+	if path == nil {
+		path = findTaskPath(graph, to, from)
+	}
+	if path == nil {
+		return highlight{}, &noPathError{
+			from: from,
+			to:   to,
+		}
+	}
+	h := highlight{
+		path:  path,
+		nodes: map[string]struct{}{},
+		edges: map[resolve.Edge]struct{}{},
+	}
+	for i, node := range path {
+		h.nodes[node] = struct{}{}
+		if i > 0 {
+			h.edges[resolve.Edge{From: path[i-1], To: node}] = struct{}{}
+		}
+	}
+	return h, nil
+}
+
+func writeDot(w io.Writer, graph *resolve.Graph, h highlight) error {
+	fmt.Fprintln(w, "digraph dpl {")
+	for _, node := range graph.Nodes {
+		attributes := ""
+		if h.hasNode(node) {
+			attributes = " [color=red, penwidth=2]"
+		}
+		fmt.Fprintf(w, "  %q%v;\n", node, attributes)
+	}
+	for _, edge := range graph.Edges {
+		attributes := ""
+		if h.hasEdge(edge) {
+			attributes = " [color=red, penwidth=2]"
+		}
+		fmt.Fprintf(w, "  %q -> %q%v;\n", edge.From, edge.To, attributes)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+type jsonGraph struct {
+	*resolve.Graph
+	Path []string `json:"path,omitempty"`
+}
+
+func writeJSON(w io.Writer, graph *resolve.Graph, h highlight) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonGraph{
+		Graph: graph,
+		Path:  h.path,
+	})
+}
+
+// writeMermaid uses generated ids, since mermaid reads the dot in
+// component.task as syntax.
+func writeMermaid(w io.Writer, graph *resolve.Graph, h highlight) error {
+	fmt.Fprintln(w, "graph LR")
+	ids := map[string]string{}
+	highlighted := []string{}
+	for i, node := range graph.Nodes {
+		ids[node] = fmt.Sprintf("n%v", i)
+		fmt.Fprintf(w, "  %v[\"%v\"]\n", ids[node], node)
+		if h.hasNode(node) {
+			highlighted = append(highlighted, ids[node])
+		}
+	}
+	highlightedEdges := []string{}
+	for i, edge := range graph.Edges {
+		fmt.Fprintf(w, "  %v --> %v\n", ids[edge.From], ids[edge.To])
+		if h.hasEdge(edge) {
+			highlightedEdges = append(highlightedEdges, fmt.Sprint(i))
+		}
+	}
+	if len(highlighted) > 0 {
+		fmt.Fprintln(w, "  classDef highlight stroke:red,stroke-width:2px")
+		fmt.Fprintf(w, "  class %v highlight\n", strings.Join(highlighted, ","))
+	}
+	if len(highlightedEdges) > 0 {
+		fmt.Fprintf(w, "  linkStyle %v stroke:red,stroke-width:2px\n", strings.Join(highlightedEdges, ","))
+	}
+	return nil
+}
+
+func writeGraph(w io.Writer, format string, graph *resolve.Graph, h highlight) error {
+	writer, found := graphWriters[format]
+	if !found {
+		return &unknownFormatError{
+			format: format,
+		}
+	}
+	return writer(w, graph, h)
+}
@@ -0,0 +1,119 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/resolve"
+)
+
+// app needs lib, which needs zlib; tool stands alone
+func makeTestGraph() *resolve.Graph {
+	return &resolve.Graph{
+		Nodes: []string{"app.build", "lib.build", "tool.build", "zlib.build"},
+		Edges: []resolve.Edge{
+			{From: "lib.build", To: "app.build"},
+			{From: "zlib.build", To: "lib.build"},
+		},
+	}
+}
+
+func TestFindPath(t *testing.T) {
+	for _, components := range [][]string{{"zlib", "app"}, {"app", "zlib"}} {
+		h, err := findPath(makeTestGraph(), components[0], components[1])
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{"zlib.build", "lib.build", "app.build"}
+		if !reflect.DeepEqual(h.path, expected) {
+			t.Fatalf("Unexpected path: %v", h.path)
+		}
+		if !h.hasEdge(resolve.Edge{From: "zlib.build", To: "lib.build"}) {
+			t.Fatalf("Missing highlighted edge")
+		}
+	}
+}
+
+func TestFindPathUnconnected(t *testing.T) {
+	_, err := findPath(makeTestGraph(), "tool", "app")
+	if _, ok := err.(*noPathError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	graph := makeTestGraph()
+	h, err := findPath(graph, "lib", "app")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output := bytes.Buffer{}
+	err = writeGraph(&output, formatDot, graph, h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"digraph dpl {",
+		`"tool.build";`,
+		`"lib.build" -> "app.build" [color=red, penwidth=2];`,
+		`"zlib.build" -> "lib.build";`,
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Fatalf("Missing %v in output:\n%v", expected, output.String())
+		}
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	graph := makeTestGraph()
+	h, err := findPath(graph, "lib", "app")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output := bytes.Buffer{}
+	err = writeGraph(&output, formatMermaid, graph, h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"graph LR",
+		`n0["app.build"]`,
+		"n1 --> n0",
+		"class n0,n1 highlight",
+		"linkStyle 0 stroke:red",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Fatalf("Missing %v in output:\n%v", expected, output.String())
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	graph := makeTestGraph()
+	output := bytes.Buffer{}
+	err := writeGraph(&output, formatJSON, graph, highlight{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parsed := resolve.Graph{}
+	err = json.Unmarshal(output.Bytes(), &parsed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(&parsed, graph) {
+		t.Fatalf("Unexpected graph: %v", parsed)
+	}
+	if strings.Contains(output.String(), "path") {
+		t.Fatalf("Unexpected path in output:\n%v", output.String())
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	err := writeGraph(&bytes.Buffer{}, "svg", makeTestGraph(), highlight{})
+	if _, ok := err.(*unknownFormatError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
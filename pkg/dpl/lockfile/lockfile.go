@@ -0,0 +1,115 @@
+package lockfile
+
+import (
+	"os"
+	"sort"
+
+	"gopkg.in/ini.v1"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/configfile"
+)
+
+const (
+	// Filename is the name of the lock file; it lives next to build.config.
+	Filename string = "build.lock"
+
+	// Unlocked marks a source whose handler can't report a revision.
+	Unlocked string = "-"
+
+	urisKey      string = "scm.uri"
+	revisionsKey string = "revision"
+)
+
+// Entry pins one component's sources.  Revisions line up with the groups of
+// alternate scm.uri values, in the order they're configured.
+type Entry struct {
+	URIs      []string
+	Revisions []string
+}
+
+// Matches reports whether the entry was made from the given scm.uri values.
+func (e Entry) Matches(uris []string) bool {
+	if len(e.URIs) != len(uris) {
+		return false
+	}
+	for i := range uris {
+		if e.URIs[i] != uris[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LockFile maps component names to their entries.
+type LockFile map[string]Entry
+
+// Load reads a lock file.  A missing lock file is empty.
+func Load(filename string) (LockFile, error) {
+	ret := LockFile{}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return ret, nil
+	}
+	config, err := configfile.LoadProjectConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range config.Sections() {
+		if section.Name() == ini.DefaultSection {
+			continue
+		}
+		entry := Entry{}
+		if section.HasKey(urisKey) {
+			entry.URIs = section.Key(urisKey).ValueWithShadows()
+		}
+		if section.HasKey(revisionsKey) {
+			entry.Revisions = section.Key(revisionsKey).ValueWithShadows()
+		}
+		ret[section.Name()] = entry
+	}
+	return ret, nil
+}
+
+func setValues(section *ini.Section, name string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	key, err := section.NewKey(name, values[0])
+	if err != nil {
+		return err
+	}
+	for _, value := range values[1:] {
+		err = key.AddShadow(value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write saves the lock file with components sorted by name, so it diffs
+// cleanly.
+func (lf LockFile) Write(filename string) error {
+	config := ini.Empty(ini.LoadOptions{
+		AllowShadows: true,
+	})
+	names := []string{}
+	for name := range lf {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		section, err := config.NewSection(name)
+		if err != nil {
+			return err
+		}
+		err = setValues(section, urisKey, lf[name].URIs)
+		if err != nil {
+			return err
+		}
+		err = setValues(section, revisionsKey, lf[name].Revisions)
+		if err != nil {
+			return err
+		}
+	}
+	return config.SaveTo(filename)
+}
@@ -0,0 +1,57 @@
+package lockfile
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	lock := LockFile{
+		"foo": {
+			URIs: []string{
+				"git://example.com/foo;ref=main;mirror=a",
+				"git://mirror.example.com/foo;ref=main;mirror=a",
+			},
+			Revisions: []string{"0123456789abcdef0123456789abcdef01234567"},
+		},
+		"bar": {
+			URIs:      []string{"local://bar", "archive+https://example.com/bar.tar.gz;sha256=abcd"},
+			Revisions: []string{Unlocked, "sha256:abcd"},
+		},
+	}
+	filename := path.Join(t.TempDir(), Filename)
+	err := lock.Write(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(lock, loaded) {
+		t.Fatalf("Unexpected lock file: %v", loaded)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	loaded, err := Load(path.Join(t.TempDir(), Filename))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(loaded) != 0 {
+		t.Fatalf("Unexpected lock file: %v", loaded)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	entry := Entry{
+		URIs: []string{"git://example.com/foo;ref=main"},
+	}
+	if !entry.Matches([]string{"git://example.com/foo;ref=main"}) {
+		t.Fatalf("Expected a match")
+	}
+	if entry.Matches([]string{"git://example.com/foo;ref=next"}) {
+		t.Fatalf("Unexpected match")
+	}
+}
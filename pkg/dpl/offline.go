@@ -0,0 +1,27 @@
+package dpl
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	// OfflineEnv turns on offline mode.  The --offline flag sets it too, so
+	// anything dpl runs can tell.
+	OfflineEnv string = "DPL_OFFLINE"
+)
+
+var (
+	// ErrOffline is wrapped by anything that can't be done without the
+	// network.
+	ErrOffline error = fmt.Errorf("network access disabled by offline mode")
+)
+
+// Offline reports whether network access is forbidden.  Handlers should
+// work from what's already on disk (existing checkouts, caches) and fail
+// only when that isn't enough.
+func Offline() bool {
+	offline, err := strconv.ParseBool(os.Getenv(OfflineEnv))
+	return err == nil && offline
+}
@@ -3,6 +3,7 @@ package resolve
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl"
@@ -23,6 +24,7 @@ type commonResolver struct {
 	revDeps    reverseDependencies
 	depCounts  map[string]int
 	readyTasks []string
+	priorities priorityMap
 }
 
 func (cr *commonResolver) workRemaining() bool {
@@ -35,6 +37,7 @@ func (cr *commonResolver) Resolve(taskChannel chan []string) {
 		for cr.workRemaining() {
 			for len(cr.readyTasks) > 0 {
 				toSend := cr.readyTasks
+				cr.priorities.sort(toSend)
 				cr.readyTasks = []string{}
 				cr.cond.L.Unlock()
 				taskChannel <- toSend
@@ -50,6 +53,28 @@ func (cr *commonResolver) Resolve(taskChannel chan []string) {
 	}()
 }
 
+func (cr *commonResolver) Next() (string, bool) {
+	cr.cond.L.Lock()
+	defer cr.cond.L.Unlock()
+
+	for len(cr.readyTasks) == 0 || cr.forceAbort {
+		if !cr.workRemaining() {
+			return "", false
+		}
+		cr.cond.Wait()
+	}
+	cr.priorities.sort(cr.readyTasks)
+	task := cr.readyTasks[0]
+	cr.readyTasks = cr.readyTasks[1:]
+	return task, true
+}
+
+func (cr *commonResolver) Shuffle(seed int64) {
+	cr.cond.L.Lock()
+	defer cr.cond.L.Unlock()
+	cr.priorities = shuffledPriorities(cr.priorities, seed)
+}
+
 func (cr *commonResolver) Complete(task string) {
 	cr.cond.L.Lock()
 	defer cr.cond.L.Unlock()
@@ -71,7 +96,7 @@ func (cr *commonResolver) Complete(task string) {
 		delete(cr.revDeps, task)
 	}
 
-	cr.cond.Signal()
+	cr.cond.Broadcast()
 }
 
 func (cr *commonResolver) failHelper(task string, failChain map[string]struct{}) {
@@ -94,7 +119,7 @@ func (cr *commonResolver) Fail(task string) []string {
 		failChain := map[string]struct{}{}
 		cr.failHelper(task, failChain)
 		delete(failChain, task)
-		cr.cond.Signal()
+		cr.cond.Broadcast()
 		return failChain
 	}()
 
@@ -104,6 +129,7 @@ func (cr *commonResolver) Fail(task string) []string {
 		failures[index] = failure
 		index++
 	}
+	sort.Strings(failures)
 	return failures
 }
 
@@ -111,11 +137,12 @@ func (cr *commonResolver) Abort() ([]string, error) {
 	cr.cond.L.Lock()
 	defer cr.cond.L.Unlock()
 	cr.forceAbort = true
-	cr.cond.Signal()
+	cr.cond.Broadcast()
 	unresolvedTasks := []string{}
 	for task := range cr.depCounts {
 		unresolvedTasks = append(unresolvedTasks, task)
 	}
+	sort.Strings(unresolvedTasks)
 	return unresolvedTasks, nil
 }
 
@@ -147,6 +174,10 @@ func addDeps(project dpl.Project, target string, tasks []string, reverseDeps rev
 			for _, depend := range rawDepends {
 				err := addDeps(project, depend, tasks[:index+1], reverseDeps)
 				if err != nil {
+					if missing, ok := err.(*ComponentNotFoundError); ok && missing.Name == depend && len(missing.RequiredBy) == 0 {
+						missing.RequiredBy = target
+						missing.Key = depKey
+					}
 					return err
 				}
 				dependsTask := makeComponentTask(depend, task)
@@ -217,7 +248,16 @@ func validateResolution(resolver *commonResolver) error {
 	return nil
 }
 
-func resolveCommon(revDeps reverseDependencies) (commonResolver, error) {
+func resolveCommon(project dpl.Project, revDeps reverseDependencies) (commonResolver, error) {
+	err := findCycles(revDeps)
+	if err != nil {
+		return commonResolver{}, err
+	}
+	priorities, err := makePriorities(project, revDeps)
+	if err != nil {
+		return commonResolver{}, err
+	}
+
 	counts := make(map[string]int)
 	for baseTask, revDep := range revDeps {
 		_, found := counts[baseTask]
@@ -252,8 +292,9 @@ func resolveCommon(revDeps reverseDependencies) (commonResolver, error) {
 		revDeps:    revDeps,
 		depCounts:  counts,
 		readyTasks: ready,
+		priorities: priorities,
 	}
-	err := validateResolution(&resolver)
+	err = validateResolution(&resolver)
 	if err != nil {
 		return commonResolver{}, err
 	}
@@ -0,0 +1,164 @@
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyCycleError describes one loop in the task graph.  Cycle reads in
+// dependency order, so each task depends on the one after it, and the last
+// entry repeats the first.
+type DependencyCycleError struct {
+	Cycle []string
+}
+
+// edgeReason names the configuration that made task depend on dependency.
+func edgeReason(task string, dependency string) string {
+	component, taskName, _ := strings.Cut(task, ".")
+	depComponent, depTaskName, _ := strings.Cut(dependency, ".")
+	if component == depComponent {
+		return fmt.Sprintf("%v: %v runs after %v", component, taskName, depTaskName)
+	}
+	return fmt.Sprintf("%v: depends.%v includes %v", component, taskName, depComponent)
+}
+
+func (dce *DependencyCycleError) Error() string {
+	reasons := []string{}
+	for i := 1; i < len(dce.Cycle); i++ {
+		reasons = append(reasons, edgeReason(dce.Cycle[i-1], dce.Cycle[i]))
+	}
+	return fmt.Sprintf("dependency cycle %v (%v)", strings.Join(dce.Cycle, " -> "), strings.Join(reasons, "; "))
+}
+
+// dependencyMap flips reverse dependencies around so each task maps to what
+// it depends on, with everything sorted to keep reports stable.
+func dependencyMap(revDeps reverseDependencies) map[string][]string {
+	deps := map[string][]string{}
+	for task, dependents := range revDeps {
+		if _, found := deps[task]; !found {
+			deps[task] = []string{}
+		}
+		for dependent := range dependents {
+			deps[dependent] = append(deps[dependent], task)
+		}
+	}
+	for task := range deps {
+		sort.Strings(deps[task])
+	}
+	return deps
+}
+
+type tarjanState struct {
+	deps       map[string][]string
+	index      map[string]int
+	lowLink    map[string]int
+	onStack    map[string]bool
+	stack      []string
+	components [][]string
+}
+
+func (ts *tarjanState) visit(task string) {
+	ts.index[task] = len(ts.index)
+	ts.lowLink[task] = ts.index[task]
+	ts.stack = append(ts.stack, task)
+	ts.onStack[task] = true
+
+	for _, dep := range ts.deps[task] {
+		if _, visited := ts.index[dep]; !visited {
+			ts.visit(dep)
+			ts.lowLink[task] = min(ts.lowLink[task], ts.lowLink[dep])
+		} else if ts.onStack[dep] {
+			ts.lowLink[task] = min(ts.lowLink[task], ts.index[dep])
+		}
+	}
+
+	if ts.lowLink[task] == ts.index[task] {
+		component := []string{}
+		for {
+			top := ts.stack[len(ts.stack)-1]
+			ts.stack = ts.stack[:len(ts.stack)-1]
+			ts.onStack[top] = false
+			component = append(component, top)
+			if top == task {
+				break
+			}
+		}
+		ts.components = append(ts.components, component)
+	}
+}
+
+// stronglyConnected finds the strongly connected components of the graph
+// with Tarjan's algorithm.
+func stronglyConnected(deps map[string][]string) [][]string {
+	ts := tarjanState{
+		deps:    deps,
+		index:   map[string]int{},
+		lowLink: map[string]int{},
+		onStack: map[string]bool{},
+	}
+	tasks := []string{}
+	for task := range deps {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	for _, task := range tasks {
+		if _, visited := ts.index[task]; !visited {
+			ts.visit(task)
+		}
+	}
+	return ts.components
+}
+
+// cycleThrough finds a shortest loop from start back to itself that stays
+// inside one strongly connected component.
+func cycleThrough(deps map[string][]string, members map[string]struct{}, start string) []string {
+	previous := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		task := queue[0]
+		queue = queue[1:]
+		for _, dep := range deps[task] {
+			if _, found := members[dep]; !found {
+				continue
+			}
+			if dep == start {
+				cycle := []string{start}
+				for ; task != start; task = previous[task] {
+					cycle = append([]string{task}, cycle...)
+				}
+				return append([]string{start}, cycle...)
+			}
+			if _, seen := previous[dep]; !seen {
+				previous[dep] = task
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// findCycles reports one loop for each strongly connected component that has
+// one.  A component with a single task only loops if it depends on itself.
+func findCycles(revDeps reverseDependencies) error {
+	deps := dependencyMap(revDeps)
+	cycleErrors := []error{}
+	for _, component := range stronglyConnected(deps) {
+		sort.Strings(component)
+		members := map[string]struct{}{}
+		for _, task := range component {
+			members[task] = exists
+		}
+		cycle := cycleThrough(deps, members, component[0])
+		if cycle != nil {
+			cycleErrors = append(cycleErrors, &DependencyCycleError{
+				Cycle: cycle,
+			})
+		}
+	}
+	sort.Slice(cycleErrors, func(i, j int) bool {
+		return cycleErrors[i].Error() < cycleErrors[j].Error()
+	})
+	return errors.Join(cycleErrors...)
+}
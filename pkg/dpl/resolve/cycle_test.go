@@ -0,0 +1,129 @@
+package resolve
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func makeDependsProject(depends map[string][]string) *testcommon.ResolveProject {
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{},
+	}
+	for name, deps := range depends {
+		project.Comps[name] = testcommon.ResolveComponent{
+			Data: map[string][]string{
+				"depends.build": deps,
+			},
+		}
+	}
+	return project
+}
+
+func expectCycles(t *testing.T, err error, expected ...[]string) {
+	if err == nil {
+		t.Fatalf("Missing expected error")
+	}
+	cycles := [][]string{}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, cycleErr := range joined.Unwrap() {
+		dce, ok := cycleErr.(*DependencyCycleError)
+		if !ok {
+			t.Fatalf("Unexpected error: %v", cycleErr)
+		}
+		cycles = append(cycles, dce.Cycle)
+	}
+	if !reflect.DeepEqual(cycles, expected) {
+		t.Fatalf("Unexpected cycles: %v", cycles)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	project := makeDependsProject(map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": {"a"},
+	})
+	_, err := resolveDeep(project, []string{"d"}, []string{"scm", "build"})
+	expectCycles(t, err, []string{"a.build", "b.build", "c.build", "a.build"})
+
+	expected := "dependency cycle a.build -> b.build -> c.build -> a.build " +
+		"(a: depends.build includes b; b: depends.build includes c; c: depends.build includes a)"
+	if err.Error() != expected {
+		t.Fatalf("Unexpected message: %v", err)
+	}
+	var dce *DependencyCycleError
+	if !errors.As(err, &dce) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCycleSelf(t *testing.T) {
+	project := makeDependsProject(map[string][]string{
+		"a": {"a"},
+	})
+	_, err := resolveDeep(project, []string{"a"}, []string{"build"})
+	expectCycles(t, err, []string{"a.build", "a.build"})
+}
+
+func TestCycleShortest(t *testing.T) {
+	// a and b form a two-task loop inside a bigger one; the short one is the
+	// clearer report
+	project := makeDependsProject(map[string][]string{
+		"a": {"b", "c"},
+		"b": {"a"},
+		"c": {"b"},
+	})
+	_, err := resolveDeep(project, []string{"a"}, []string{"build"})
+	expectCycles(t, err, []string{"a.build", "b.build", "a.build"})
+}
+
+func TestCycleMultiple(t *testing.T) {
+	project := makeDependsProject(map[string][]string{
+		"a": {"b"},
+		"b": {"a"},
+		"x": {"y"},
+		"y": {"x"},
+	})
+	_, err := resolveReverse(project, []string{"a", "b", "x", "y"}, []string{"build"})
+	expectCycles(t, err,
+		[]string{"a.build", "b.build", "a.build"},
+		[]string{"x.build", "y.build", "x.build"})
+}
+
+func TestNoCycle(t *testing.T) {
+	project := makeDependsProject(map[string][]string{
+		"a": {"b", "c"},
+		"b": {"c"},
+		"c": nil,
+	})
+	_, err := resolveDeep(project, []string{"a"}, []string{"scm", "build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestMissingDependencyNamed(t *testing.T) {
+	project := makeDependsProject(map[string][]string{
+		"a": {"b"},
+		"b": {"zlib"},
+	})
+	_, err := resolveDeep(project, []string{"a"}, []string{"build"})
+	missing, ok := err.(*ComponentNotFoundError)
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if missing.Name != "zlib" || missing.RequiredBy != "b" || missing.Key != "depends.build" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(err.Error(), "zlib, required by b in depends.build") {
+		t.Fatalf("Unexpected message: %v", err)
+	}
+}
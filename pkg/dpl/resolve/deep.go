@@ -8,12 +8,18 @@ type deepResolver struct {
 	commonResolver
 }
 
+// deepDependencies is every task the targets need, including everything
+// they depend on.
+func deepDependencies(project dpl.Project, targets []string, tasks []string) (reverseDependencies, error) {
+	return makeReverseDependencies(project, targets, tasks)
+}
+
 func resolveDeep(project dpl.Project, targets []string, tasks []string) (*deepResolver, error) {
-	revDeps, err := makeReverseDependencies(project, targets, tasks)
+	revDeps, err := deepDependencies(project, targets, tasks)
 	if err != nil {
 		return nil, err
 	}
-	common, err := resolveCommon(revDeps)
+	common, err := resolveCommon(project, revDeps)
 	if err != nil {
 		return nil, err
 	}
@@ -26,4 +32,5 @@ func init() {
 	RegisterResolver("deep", func(project dpl.Project, targets []string, tasks []string) (Resolver, error) {
 		return resolveDeep(project, targets, tasks)
 	})
+	registerDependencies("deep", deepDependencies)
 }
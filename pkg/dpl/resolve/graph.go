@@ -0,0 +1,74 @@
+package resolve
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type dependencyFn func(dpl.Project, []string, []string) (reverseDependencies, error)
+
+var (
+	dependencyFns = map[string]dependencyFn{}
+)
+
+// registerDependencies makes the graph a resolver schedules from available to
+// MakeGraph.  Resolvers should register under the same name they use in
+// RegisterResolver.
+func registerDependencies(name string, fn dependencyFn) {
+	dependencyFns[name] = fn
+}
+
+// Edge means To can't start until From completes.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph is the set of component tasks a resolver would schedule, in
+// component.task form.  Nodes and Edges are sorted.
+type Graph struct {
+	Nodes []string `json:"nodes"`
+	Edges []Edge   `json:"edges"`
+}
+
+// MakeGraph builds the graph the named resolver would schedule for targets.
+// Cycles aren't rejected, so they can be looked at.
+func MakeGraph(name string, project dpl.Project, targets []string, tasks []string) (*Graph, error) {
+	fn, found := dependencyFns[name]
+	if !found {
+		return nil, fmt.Errorf("no resolver '%v'", name)
+	}
+	revDeps, err := fn(project, targets, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := map[string]struct{}{}
+	graph := &Graph{
+		Nodes: []string{},
+		Edges: []Edge{},
+	}
+	for task, dependents := range revDeps {
+		nodes[task] = exists
+		for dependent := range dependents {
+			nodes[dependent] = exists
+			graph.Edges = append(graph.Edges, Edge{
+				From: task,
+				To:   dependent,
+			})
+		}
+	}
+	for node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Strings(graph.Nodes)
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph, nil
+}
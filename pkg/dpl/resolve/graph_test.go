@@ -0,0 +1,65 @@
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func makeGraphProject() *testcommon.ResolveProject {
+	return &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": testcommon.ResolveComponent{},
+			"bar": testcommon.ResolveComponent{
+				Data: map[string][]string{
+					"depends.build": {"foo"},
+				},
+			},
+			"baz": testcommon.ResolveComponent{},
+		},
+	}
+}
+
+func TestGraphDeep(t *testing.T) {
+	graph, err := MakeGraph("deep", makeGraphProject(), []string{"bar"}, []string{"scm", "build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedNodes := []string{"bar.build", "bar.scm", "foo.build", "foo.scm"}
+	if !reflect.DeepEqual(graph.Nodes, expectedNodes) {
+		t.Fatalf("Unexpected nodes: %v", graph.Nodes)
+	}
+	expectedEdges := []Edge{
+		{From: "bar.scm", To: "bar.build"},
+		{From: "foo.build", To: "bar.build"},
+		{From: "foo.scm", To: "foo.build"},
+	}
+	if !reflect.DeepEqual(graph.Edges, expectedEdges) {
+		t.Fatalf("Unexpected edges: %v", graph.Edges)
+	}
+}
+
+func TestGraphReverse(t *testing.T) {
+	graph, err := MakeGraph("reverse", makeGraphProject(), []string{"foo"}, []string{"build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedNodes := []string{"bar.build", "foo.build"}
+	if !reflect.DeepEqual(graph.Nodes, expectedNodes) {
+		t.Fatalf("Unexpected nodes: %v", graph.Nodes)
+	}
+	expectedEdges := []Edge{
+		{From: "foo.build", To: "bar.build"},
+	}
+	if !reflect.DeepEqual(graph.Edges, expectedEdges) {
+		t.Fatalf("Unexpected edges: %v", graph.Edges)
+	}
+}
+
+func TestGraphUnknownResolver(t *testing.T) {
+	_, err := MakeGraph("missing", makeGraphProject(), []string{"foo"}, []string{"build"})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
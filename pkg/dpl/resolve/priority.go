@@ -0,0 +1,274 @@
+package resolve
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	// taskPriorityKey lets a component jump the queue; higher runs first.
+	// It beats anything the critical path says.
+	taskPriorityKey string = "task.priority"
+
+	// durations live in the build directory's control directory, next to
+	// (but not in) the build cache, so reconfiguring doesn't lose them
+	controlDirName    string = ".dpl"
+	durationsFileName string = "durations"
+
+	// stands in for every task's duration when there's no history at all,
+	// so the longest chain of tasks starts first
+	defaultDuration time.Duration = time.Second
+)
+
+type invalidPriorityError struct {
+	component string
+	value     string
+}
+
+func (ipe *invalidPriorityError) Error() string {
+	return fmt.Sprintf("%v has an invalid %v (%v)", ipe.component, taskPriorityKey, ipe.value)
+}
+
+var (
+	// tasks run in parallel, so recording has to take turns with the file
+	durationsLock sync.Mutex
+)
+
+// durationsFile is where component's durations are kept.  Work directories
+// sit directly in the build directory, so that's found from component's.
+func durationsFile(component dpl.Component) string {
+	return path.Join(path.Dir(component.GetWorkDir()), controlDirName, durationsFileName)
+}
+
+// readDurations loads every duration in filename, keyed by task.  Each line
+// is a task and how long it took; anything unusable is skipped.
+func readDurations(filename string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return durations, nil
+	}
+	if err != nil {
+		return durations, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		task, raw, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		duration, err := time.ParseDuration(raw)
+		if err != nil || duration < 0 {
+			continue
+		}
+		durations[task] = duration
+	}
+	if err := scanner.Err(); err != nil {
+		return map[string]time.Duration{}, err
+	}
+	return durations, nil
+}
+
+func writeDurations(filename string, durations map[string]time.Duration) error {
+	tasks := []string{}
+	for task := range durations {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	contents := strings.Builder{}
+	for _, task := range tasks {
+		fmt.Fprintf(&contents, "%v %v\n", task, durations[task])
+	}
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	scratch := filename + ".tmp"
+	err = os.WriteFile(scratch, []byte(contents.String()), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(scratch, filename)
+}
+
+// RecordDuration remembers how long a successful task took, so the next run
+// can start long chains of work early.
+func RecordDuration(component dpl.Component, task string, duration time.Duration) error {
+	durationsLock.Lock()
+	defer durationsLock.Unlock()
+	filename := durationsFile(component)
+	durations, err := readDurations(filename)
+	if err != nil {
+		return err
+	}
+	durations[fmt.Sprintf("%v.%v", component.Name(), task)] = duration.Round(time.Millisecond)
+	return writeDurations(filename, durations)
+}
+
+// taskPriority is everything that decides which ready task goes first.
+type taskPriority struct {
+	explicit int
+	// the longest chain of work, by expected duration, that's waiting on
+	// this task (including the task itself)
+	criticalPath time.Duration
+}
+
+type priorityMap map[string]taskPriority
+
+// less reports whether first should run before second.  Names break ties
+// so the order is always the same.
+func (pm priorityMap) less(first string, second string) bool {
+	firstPriority := pm[first]
+	secondPriority := pm[second]
+	if firstPriority.explicit != secondPriority.explicit {
+		return firstPriority.explicit > secondPriority.explicit
+	}
+	if firstPriority.criticalPath != secondPriority.criticalPath {
+		return firstPriority.criticalPath > secondPriority.criticalPath
+	}
+	return first < second
+}
+
+func (pm priorityMap) sort(tasks []string) {
+	sort.Slice(tasks, func(i, j int) bool {
+		return pm.less(tasks[i], tasks[j])
+	})
+}
+
+type taskInfo struct {
+	explicit int
+	duration time.Duration
+}
+
+func loadTaskInfo(project dpl.Project, revDeps reverseDependencies) (map[string]taskInfo, error) {
+	tasks := map[string]struct{}{}
+	for task, dependents := range revDeps {
+		tasks[task] = exists
+		for dependent := range dependents {
+			tasks[dependent] = exists
+		}
+	}
+
+	// components almost always share a build directory, so each file is only
+	// read once
+	durationFiles := map[string]map[string]time.Duration{}
+	infos := map[string]taskInfo{}
+	for componentTask := range tasks {
+		componentName, _, _ := strings.Cut(componentTask, ".")
+		component, err := project.GetComponent(componentName)
+		if err != nil {
+			return nil, &ComponentNotFoundError{
+				Name: componentName,
+				err:  err,
+			}
+		}
+		filename := durationsFile(component)
+		durations, found := durationFiles[filename]
+		if !found {
+			// durations are only a hint, so a broken file just means no
+			// history
+			durations, _ = readDurations(filename)
+			durationFiles[filename] = durations
+		}
+		info := taskInfo{
+			duration: durations[componentTask],
+		}
+		rawPriority, err := dpl.GetSingleComponentValueOrDefault(component, taskPriorityKey, "0")
+		if err != nil {
+			return nil, err
+		}
+		info.explicit, err = strconv.Atoi(rawPriority)
+		if err != nil {
+			return nil, &invalidPriorityError{
+				component: componentName,
+				value:     rawPriority,
+			}
+		}
+		infos[componentTask] = info
+	}
+	return infos, nil
+}
+
+// fillUnknownDurations guesses that tasks without history take as long as
+// the average task that has one.
+func fillUnknownDurations(infos map[string]taskInfo) {
+	total := time.Duration(0)
+	known := 0
+	for _, info := range infos {
+		if info.duration > 0 {
+			total += info.duration
+			known++
+		}
+	}
+	guess := defaultDuration
+	if known > 0 {
+		guess = total / time.Duration(known)
+	}
+	for task, info := range infos {
+		if info.duration == 0 {
+			info.duration = guess
+			infos[task] = info
+		}
+	}
+}
+
+func criticalPath(task string, revDeps reverseDependencies, infos map[string]taskInfo, paths map[string]time.Duration) time.Duration {
+	if path, found := paths[task]; found {
+		return path
+	}
+	longest := time.Duration(0)
+	for dependent := range revDeps[task] {
+		longest = max(longest, criticalPath(dependent, revDeps, infos, paths))
+	}
+	paths[task] = infos[task].duration + longest
+	return paths[task]
+}
+
+// makePriorities ranks every task in the graph.  The graph has to be free of
+// cycles.
+func makePriorities(project dpl.Project, revDeps reverseDependencies) (priorityMap, error) {
+	infos, err := loadTaskInfo(project, revDeps)
+	if err != nil {
+		return nil, err
+	}
+	fillUnknownDurations(infos)
+	paths := map[string]time.Duration{}
+	priorities := priorityMap{}
+	for task, info := range infos {
+		priorities[task] = taskPriority{
+			explicit:     info.explicit,
+			criticalPath: criticalPath(task, revDeps, infos, paths),
+		}
+	}
+	return priorities, nil
+}
+
+// shuffledPriorities ranks tasks randomly, but the same way every time for a
+// given seed and graph.  The ranks go in as explicit priorities so nothing
+// else gets a say.
+func shuffledPriorities(priorities priorityMap, seed int64) priorityMap {
+	tasks := []string{}
+	for task := range priorities {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	ranks := rand.New(rand.NewSource(seed)).Perm(len(tasks))
+	shuffled := priorityMap{}
+	for i, task := range tasks {
+		shuffled[task] = taskPriority{
+			explicit: ranks[i],
+		}
+	}
+	return shuffled
+}
@@ -0,0 +1,222 @@
+package resolve
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+// chain1 <- chain2 <- chain3 is the long way round; alone has nothing
+// waiting on it
+func makePriorityProject(data map[string]map[string][]string) *testcommon.ResolveProject {
+	project := &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"alone":  testcommon.ResolveComponent{Data: map[string][]string{}},
+			"chain1": testcommon.ResolveComponent{Data: map[string][]string{}},
+			"chain2": testcommon.ResolveComponent{Data: map[string][]string{
+				"depends.build": {"chain1"},
+			}},
+			"chain3": testcommon.ResolveComponent{Data: map[string][]string{
+				"depends.build": {"chain2"},
+			}},
+		},
+	}
+	for name, values := range data {
+		for key, value := range values {
+			project.Comps[name].Data[key] = value
+		}
+	}
+	return project
+}
+
+// recordDurations gives every component a work directory in the same build
+// directory and records the given build durations there.
+func recordDurations(t *testing.T, project *testcommon.ResolveProject, durations map[string]time.Duration) {
+	buildDir := t.TempDir()
+	for name, component := range project.Comps {
+		component.ComponentName = name
+		component.WorkDir = path.Join(buildDir, name)
+		project.Comps[name] = component
+	}
+	for name, duration := range durations {
+		component := project.Comps[name]
+		err := RecordDuration(&component, "build", duration)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func expectFirstReady(t *testing.T, project *testcommon.ResolveProject, expected []string) {
+	resolver, err := resolveDeep(project, project.ComponentNames(), []string{"build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	taskChannel := make(chan []string)
+	resolver.Resolve(taskChannel)
+	ready := <-taskChannel
+	if !reflect.DeepEqual(ready, expected) {
+		t.Fatalf("Unexpected order: %v", ready)
+	}
+	resolver.Abort()
+}
+
+func TestPriorityNoHistory(t *testing.T) {
+	expectFirstReady(t, makePriorityProject(nil), []string{"chain1.build", "alone.build"})
+}
+
+func TestPriorityDuration(t *testing.T) {
+	project := makePriorityProject(nil)
+	recordDurations(t, project, map[string]time.Duration{
+		"alone":  10 * time.Minute,
+		"chain1": time.Minute,
+		"chain2": time.Minute,
+		"chain3": time.Minute,
+	})
+	expectFirstReady(t, project, []string{"alone.build", "chain1.build"})
+}
+
+func TestPriorityUnknownDuration(t *testing.T) {
+	// chain2 and chain3 are guessed at the average, so the chain still wins
+	project := makePriorityProject(nil)
+	recordDurations(t, project, map[string]time.Duration{
+		"alone":  4 * time.Minute,
+		"chain1": time.Minute,
+	})
+	expectFirstReady(t, project, []string{"chain1.build", "alone.build"})
+}
+
+func TestPriorityExplicit(t *testing.T) {
+	expectFirstReady(t, makePriorityProject(map[string]map[string][]string{
+		"alone": {taskPriorityKey: {"1"}},
+	}), []string{"alone.build", "chain1.build"})
+}
+
+func TestPriorityInvalid(t *testing.T) {
+	project := makePriorityProject(map[string]map[string][]string{
+		"alone": {taskPriorityKey: {"high"}},
+	})
+	_, err := resolveDeep(project, project.ComponentNames(), []string{"build"})
+	if _, ok := err.(*invalidPriorityError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRecordDuration(t *testing.T) {
+	buildDir := t.TempDir()
+	data := map[string][]string{}
+	foo := &testcommon.ResolveComponent{ComponentName: "foo", WorkDir: path.Join(buildDir, "foo"), Data: data}
+	bar := &testcommon.ResolveComponent{ComponentName: "bar", WorkDir: path.Join(buildDir, "bar")}
+	for _, record := range []struct {
+		component *testcommon.ResolveComponent
+		duration  time.Duration
+	}{
+		{foo, 1500*time.Millisecond + time.Microsecond},
+		{bar, time.Minute},
+	} {
+		err := RecordDuration(record.component, "build", record.duration)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	durations, err := readDurations(path.Join(buildDir, controlDirName, durationsFileName))
+	expected := map[string]time.Duration{
+		"foo.build": 1500 * time.Millisecond,
+		"bar.build": time.Minute,
+	}
+	if err != nil || !reflect.DeepEqual(durations, expected) {
+		t.Fatalf("Unexpected durations (%v): %v", err, durations)
+	}
+	// nothing goes into the component, so the build cache stays as it was
+	if len(data) != 0 {
+		t.Fatalf("Unexpected values: %v", data)
+	}
+}
+
+func TestReadDurations(t *testing.T) {
+	durations, err := readDurations(path.Join(t.TempDir(), durationsFileName))
+	if err != nil || len(durations) != 0 {
+		t.Fatalf("Unexpected durations (%v): %v", err, durations)
+	}
+	filename := path.Join(t.TempDir(), durationsFileName)
+	err = os.WriteFile(filename, []byte("foo.build soon\nbar.build 2s\n"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	durations, err = readDurations(filename)
+	if err != nil || !reflect.DeepEqual(durations, map[string]time.Duration{"bar.build": 2 * time.Second}) {
+		t.Fatalf("Unexpected durations (%v): %v", err, durations)
+	}
+}
+
+func TestNext(t *testing.T) {
+	project := makePriorityProject(nil)
+	resolver, err := resolveDeep(project, project.ComponentNames(), []string{"build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	order := []string{}
+	for {
+		task, ok := resolver.Next()
+		if !ok {
+			break
+		}
+		order = append(order, task)
+		resolver.Complete(task)
+	}
+	expected := []string{"chain1.build", "chain2.build", "alone.build", "chain3.build"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Unexpected order: %v", order)
+	}
+}
+
+func nextOrder(t *testing.T, project *testcommon.ResolveProject, seed *int64) []string {
+	resolver, err := resolveDeep(project, project.ComponentNames(), []string{"scm", "build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if seed != nil {
+		resolver.Shuffle(*seed)
+	}
+	order := []string{}
+	for {
+		task, ok := resolver.Next()
+		if !ok {
+			return order
+		}
+		order = append(order, task)
+		resolver.Complete(task)
+	}
+}
+
+func TestStableOrder(t *testing.T) {
+	first := nextOrder(t, makePriorityProject(nil), nil)
+	for i := 0; i < 10; i++ {
+		if order := nextOrder(t, makePriorityProject(nil), nil); !reflect.DeepEqual(order, first) {
+			t.Fatalf("Order changed (%v vs %v)", order, first)
+		}
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	unshuffled := nextOrder(t, makePriorityProject(nil), nil)
+	changed := false
+	for seed := int64(0); seed < 10; seed++ {
+		order := nextOrder(t, makePriorityProject(nil), &seed)
+		if again := nextOrder(t, makePriorityProject(nil), &seed); !reflect.DeepEqual(order, again) {
+			t.Fatalf("Seed %v isn't reproducible (%v vs %v)", seed, order, again)
+		}
+		if len(order) != len(unshuffled) {
+			t.Fatalf("Unexpected order: %v", order)
+		}
+		changed = changed || !reflect.DeepEqual(order, unshuffled)
+	}
+	if !changed {
+		t.Fatalf("Shuffling never changed the order")
+	}
+}
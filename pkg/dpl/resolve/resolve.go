@@ -7,12 +7,27 @@ import (
 )
 
 type Resolver interface {
+	// Resolve sends batches of ready tasks, most critical first, and closes
+	// the channel once everything is done.
 	Resolve(taskChannel chan []string)
 	Complete(task string)
 	Fail(task string) []string
 	Abort() ([]string, error)
 }
 
+// SchedulingResolver is a Resolver that can also hand out ready tasks one at
+// a time, so each pick weighs everything that's ready at that moment.  Next
+// replaces Resolve for callers that use it.
+type SchedulingResolver interface {
+	Resolver
+	// Next waits for a ready task and returns the most critical one, or false
+	// once there's nothing left to hand out.
+	Next() (string, bool)
+	// Shuffle replaces the usual priorities with a random order that's the
+	// same for every run with the same seed.
+	Shuffle(seed int64)
+}
+
 type ResolveFn func(dpl.Project, []string, []string) (Resolver, error)
 
 var (
@@ -34,10 +49,17 @@ func GetResolver(name string) ResolveFn {
 
 type ComponentNotFoundError struct {
 	Name string
-	err  error
+	// RequiredBy and Key say which component's configuration asked for Name;
+	// they're empty when Name was a target.
+	RequiredBy string
+	Key        string
+	err        error
 }
 
 func (cnfe *ComponentNotFoundError) Error() string {
+	if len(cnfe.RequiredBy) > 0 {
+		return fmt.Sprintf("Couldn't find component %v, required by %v in %v (%v)", cnfe.Name, cnfe.RequiredBy, cnfe.Key, cnfe.err)
+	}
 	return fmt.Sprintf("Couldn't find component %v (%v)", cnfe.Name, cnfe.err)
 }
 
@@ -32,14 +32,23 @@ func trimReverseDependencies(fullDeps reverseDependencies, targets []string, tas
 	return required
 }
 
-func resolveReverse(project dpl.Project, targets []string, tasks []string) (*reverseResolver, error) {
+// dependentDependencies is every task that depends on the targets, found by
+// building the whole project's graph and trimming it.
+func dependentDependencies(project dpl.Project, targets []string, tasks []string) (reverseDependencies, error) {
 	revDeps, err := makeReverseDependencies(project, project.ComponentNames(), tasks)
 	if err != nil {
 		return nil, err
 	}
-	trimmedDeps := trimReverseDependencies(revDeps, targets, tasks)
+	return trimReverseDependencies(revDeps, targets, tasks), nil
+}
+
+func resolveReverse(project dpl.Project, targets []string, tasks []string) (*reverseResolver, error) {
+	trimmedDeps, err := dependentDependencies(project, targets, tasks)
+	if err != nil {
+		return nil, err
+	}
 
-	common, err := resolveCommon(trimmedDeps)
+	common, err := resolveCommon(project, trimmedDeps)
 	if err != nil {
 		return nil, err
 	}
@@ -52,4 +61,5 @@ func init() {
 	RegisterResolver("reverse", func(project dpl.Project, targets []string, tasks []string) (Resolver, error) {
 		return resolveReverse(project, targets, tasks)
 	})
+	registerDependencies("reverse", dependentDependencies)
 }
@@ -0,0 +1,489 @@
+package scm
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	archiveCacheDirKey string = "scm.archive.cache_dir"
+
+	sha256Arg      string = "sha256"
+	sha512Arg      string = "sha512"
+	stripArg       string = "strip"
+	formatArg      string = "format"
+	archivePathArg string = "path"
+
+	// records which archive a source directory was extracted from
+	archiveMarker string = ".dpl-archive"
+	// appended to a marker's name for the list of what was extracted
+	manifestSuffix string = ".files"
+)
+
+type checksumMismatchError struct {
+	url      string
+	expected string
+	actual   string
+}
+
+func (cme *checksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %v (expected %v, got %v)", cme.url, cme.expected, cme.actual)
+}
+
+type archiveChecksum struct {
+	algorithm string
+	digest    string
+}
+
+func (ac archiveChecksum) String() string {
+	return fmt.Sprintf("%v:%v", ac.algorithm, ac.digest)
+}
+
+func (ac archiveChecksum) newHash() hash.Hash {
+	if ac.algorithm == sha512Arg {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func getArchiveChecksum(info ScmInfo) (archiveChecksum, error) {
+	for _, algorithm := range []string{sha512Arg, sha256Arg} {
+		if digest, found := info.Arguments[algorithm]; found {
+			return archiveChecksum{
+				algorithm: algorithm,
+				digest:    strings.ToLower(digest),
+			}, nil
+		}
+	}
+	return archiveChecksum{}, fmt.Errorf("archives need a sha256 or sha512 checksum")
+}
+
+func defaultArchiveCacheDir() (string, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(homedir, ".dev-pipeline", "archive-cache"), nil
+}
+
+func getArchiveCacheDir(component dpl.Component) (string, error) {
+	fallback, err := defaultArchiveCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return dpl.GetSingleComponentValueOrDefault(component, archiveCacheDirKey, fallback)
+}
+
+// archiveURL turns the scheme (e.g., archive+https) back into a URL for the
+// transport after the plus.
+func archiveURL(info ScmInfo) (string, error) {
+	_, transport, found := strings.Cut(info.Scheme, "+")
+	if !found {
+		return "", fmt.Errorf("archive scheme needs a transport (e.g., archive+https)")
+	}
+	return fmt.Sprintf("%v://%v", transport, info.Path), nil
+}
+
+func openArchiveSource(ctx context.Context, url string) (io.ReadCloser, error) {
+	if filename, found := strings.CutPrefix(url, "file://"); found {
+		return os.Open(filename)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("couldn't download %v (%v)", url, response.Status)
+	}
+	return response.Body, nil
+}
+
+func hashFile(filename string, checksum archiveChecksum) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := checksum.newHash()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func downloadArchive(ctx context.Context, url string, filename string, checksum archiveChecksum) error {
+	source, err := openArchiveSource(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	err = os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(path.Dir(filename), "download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := checksum.newHash()
+	_, err = io.Copy(io.MultiWriter(tmp, h), source)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != checksum.digest {
+		return &checksumMismatchError{
+			url:      url,
+			expected: checksum.digest,
+			actual:   actual,
+		}
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// fetchArchive makes sure the cache holds a verified copy of the archive and
+// returns its path.  Cached archives are named by their checksum, so they're
+// shared between components and build directories.  Offline, only local files
+// can fill the cache.
+func fetchArchive(ctx context.Context, cacheDir string, url string, checksum archiveChecksum) (string, error) {
+	filename := path.Join(cacheDir, checksum.algorithm, checksum.digest)
+	actual, err := hashFile(filename, checksum)
+	if err == nil && actual == checksum.digest {
+		return filename, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if dpl.Offline() && !strings.HasPrefix(url, "file://") {
+		return "", fmt.Errorf("%w (%v isn't cached)", dpl.ErrOffline, url)
+	}
+	return filename, downloadArchive(ctx, url, filename, checksum)
+}
+
+func readMarker(srcDir string, marker string) string {
+	contents, err := os.ReadFile(path.Join(srcDir, marker))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+// writeMarker records where srcDir came from, along with a manifest of what
+// was put there for findLocalEdits to compare against.
+func writeMarker(srcDir string, marker string, source string, fingerprints map[string]string) error {
+	manifest, err := json.MarshalIndent(fingerprints, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path.Join(srcDir, marker+manifestSuffix), manifest, 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(srcDir, marker), []byte(source+"\n"), 0644)
+}
+
+type localEditsError struct {
+	dir       string
+	modified  []string
+	untracked []string
+}
+
+func (lee *localEditsError) Error() string {
+	lines := []string{
+		fmt.Sprintf("replacing %v would lose local changes (use --force to discard them)", lee.dir),
+	}
+	for _, filename := range lee.modified {
+		lines = append(lines, fmt.Sprintf("  modified:  %v", filename))
+	}
+	for _, filename := range lee.untracked {
+		lines = append(lines, fmt.Sprintf("  untracked: %v", filename))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fingerprintTree records what each file and symbolic link under dir looks
+// like, keyed by slash-separated relative path.  Anything named in skip (at
+// the top level) is left out.
+func fingerprintTree(dir string, skip ...string) (map[string]string, error) {
+	fingerprints := map[string]string{}
+	err := filepath.WalkDir(dir, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(skip, rel) {
+			return nil
+		}
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(filename)
+			if err != nil {
+				return err
+			}
+			fingerprints[rel] = "link:" + target
+
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			digest, err := hashFile(filename, archiveChecksum{algorithm: sha256Arg})
+			if err != nil {
+				return err
+			}
+			fingerprints[rel] = fmt.Sprintf("file:%v:%v", info.Mode().Perm(), digest)
+		}
+		return nil
+	})
+	return fingerprints, err
+}
+
+// findLocalEdits compares srcDir against the manifest written when it was
+// populated.  A tree without a manifest can't be checked, so it's treated
+// as entirely modified.
+func findLocalEdits(srcDir string, marker string) (*localEditsError, error) {
+	manifest := marker + manifestSuffix
+	current, err := fingerprintTree(srcDir, marker, manifest)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path.Join(srcDir, manifest))
+	if os.IsNotExist(err) {
+		return &localEditsError{
+			dir:      srcDir,
+			modified: []string{fmt.Sprintf("(%v is missing)", manifest)},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	recorded := map[string]string{}
+	err = json.Unmarshal(contents, &recorded)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %v: %w", path.Join(srcDir, manifest), err)
+	}
+	edits := &localEditsError{
+		dir:       srcDir,
+		modified:  []string{},
+		untracked: []string{},
+	}
+	for name, fingerprint := range recorded {
+		if current[name] != fingerprint {
+			edits.modified = append(edits.modified, name)
+		}
+	}
+	for name := range current {
+		if _, found := recorded[name]; !found {
+			edits.untracked = append(edits.untracked, name)
+		}
+	}
+	if len(edits.modified) == 0 && len(edits.untracked) == 0 {
+		return nil, nil
+	}
+	sort.Strings(edits.modified)
+	sort.Strings(edits.untracked)
+	return edits, nil
+}
+
+// replaceSourceDir extracts into a scratch directory next to srcDir and swaps
+// it in, so a failed extraction never leaves a half-populated tree behind.
+// The marker records where the tree came from, and a manifest next to it
+// records what was extracted so local changes are only discarded with force.
+func replaceSourceDir(srcDir string, marker string, source string, force bool, extract func(dest string) error) error {
+	if !force && len(readMarker(srcDir, marker)) > 0 {
+		edits, err := findLocalEdits(srcDir, marker)
+		if err != nil {
+			return err
+		}
+		if edits != nil {
+			return edits
+		}
+	}
+	err := os.MkdirAll(path.Dir(srcDir), 0755)
+	if err != nil {
+		return err
+	}
+	scratch, err := os.MkdirTemp(path.Dir(srcDir), ".dpl-extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	err = extract(scratch)
+	if err != nil {
+		return err
+	}
+	fingerprints, err := fingerprintTree(scratch)
+	if err != nil {
+		return err
+	}
+	err = writeMarker(scratch, marker, source, fingerprints)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(srcDir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(scratch, srcDir)
+}
+
+func archiveSourceDir(component dpl.Component, info ScmInfo) (string, error) {
+	srcDir := component.GetSourceDir()
+	if offset, found := info.Arguments[archivePathArg]; found {
+		if !ContainedPath(offset) {
+			return "", fmt.Errorf("invalid value for argument '%v' (%v)", archivePathArg, offset)
+		}
+		srcDir = path.Join(srcDir, offset)
+	}
+	return srcDir, nil
+}
+
+type archiveHandler struct {
+	component dpl.Component
+}
+
+func (ah *archiveHandler) Checkout(info ScmInfo) error {
+	return ah.CheckoutContext(context.Background(), info)
+}
+
+func (ah *archiveHandler) CheckoutContext(ctx context.Context, info ScmInfo) error {
+	checksum, err := getArchiveChecksum(info)
+	if err != nil {
+		return err
+	}
+	url, err := archiveURL(info)
+	if err != nil {
+		return err
+	}
+	strip := 0
+	if rawStrip, found := info.Arguments[stripArg]; found {
+		strip, err = strconv.Atoi(rawStrip)
+		if err != nil || strip < 0 {
+			return fmt.Errorf("invalid value for argument '%v' (%v)", stripArg, rawStrip)
+		}
+	}
+	format, found := info.Arguments[formatArg]
+	if !found {
+		filename, _, _ := strings.Cut(info.Path, "?")
+		format, err = guessFormat(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(info.Options.Revision) > 0 && info.Options.Revision != checksum.String() {
+		return &checksumMismatchError{
+			url:      url,
+			expected: info.Options.Revision,
+			actual:   checksum.String(),
+		}
+	}
+
+	srcDir, err := archiveSourceDir(ah.component, info)
+	if err != nil {
+		return err
+	}
+	previous := readMarker(srcDir, archiveMarker)
+	if previous == checksum.String() {
+		return nil
+	}
+	if len(previous) > 0 && info.Options.Update == UpdateNever {
+		return nil
+	}
+	if len(previous) == 0 && !info.Options.Force {
+		// don't wipe out a directory some other tool (or person) populated
+		entries, err := os.ReadDir(srcDir)
+		if err == nil && len(entries) > 0 {
+			return fmt.Errorf("%v isn't empty and wasn't extracted from an archive (use --force to replace it)", srcDir)
+		}
+	}
+
+	cacheDir, err := getArchiveCacheDir(ah.component)
+	if err != nil {
+		return err
+	}
+	archive, err := fetchArchive(ctx, cacheDir, url, checksum)
+	if err != nil {
+		return err
+	}
+	err = replaceSourceDir(srcDir, archiveMarker, checksum.String(), info.Options.Force, func(dest string) error {
+		return extractArchive(archive, format, dest, strip)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%v: extracted %v", ah.component.Name(), url)
+	return nil
+}
+
+// Status reports the checksum of the archive a source directory was
+// extracted from as its commit.
+func (ah *archiveHandler) Status(info ScmInfo) (*SourceStatus, error) {
+	checksum, err := getArchiveChecksum(info)
+	if err != nil {
+		return nil, err
+	}
+	srcDir, err := archiveSourceDir(ah.component, info)
+	if err != nil {
+		return nil, err
+	}
+	previous := readMarker(srcDir, archiveMarker)
+	if len(previous) == 0 {
+		return &SourceStatus{
+			Missing: true,
+		}, nil
+	}
+	return &SourceStatus{
+		Commit:     previous,
+		Ref:        checksum.String(),
+		MatchesRef: previous == checksum.String(),
+	}, nil
+}
+
+func makeArchive(component dpl.Component) (ScmHandler, error) {
+	return &archiveHandler{
+		component: component,
+	}, nil
+}
+
+func init() {
+	err := AddHandler("archive", makeArchive)
+	if err != nil {
+		log.Fatalf("Error registering archive handler: %v", err)
+	}
+}
@@ -0,0 +1,495 @@
+package scm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type archiveEntry struct {
+	name     string
+	contents string
+	linkname string
+	// makes linkname a hard link instead of a symbolic one
+	hardlink bool
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []archiveEntry) {
+	writer := tar.NewWriter(w)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Mode:     0644,
+			Size:     int64(len(entry.contents)),
+			Typeflag: tar.TypeReg,
+		}
+		if len(entry.linkname) > 0 {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.linkname
+			header.Size = 0
+			if entry.hardlink {
+				header.Typeflag = tar.TypeLink
+			}
+		}
+		err := writer.WriteHeader(header)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = writer.Write([]byte(entry.contents))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func writeZip(t *testing.T, w io.Writer, entries []archiveEntry) {
+	writer := zip.NewWriter(w)
+	for _, entry := range entries {
+		f, err := writer.Create(entry.name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = f.Write([]byte(entry.contents))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func buildArchive(t *testing.T, format string, entries []archiveEntry) []byte {
+	buffer := &bytes.Buffer{}
+	var compressor io.WriteCloser
+	var err error
+	switch format {
+	case formatZip:
+		writeZip(t, buffer, entries)
+		return buffer.Bytes()
+
+	case formatTarGz:
+		compressor = gzip.NewWriter(buffer)
+
+	case formatTarXz:
+		compressor, err = xz.NewWriter(buffer)
+
+	case formatTarZst:
+		compressor, err = zstd.NewWriter(buffer)
+
+	default:
+		t.Fatalf("Unexpected format: %v", format)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	writeTar(t, compressor, entries)
+	err = compressor.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func sha256Hex(contents []byte) string {
+	digest := sha256.Sum256(contents)
+	return hex.EncodeToString(digest[:])
+}
+
+// archiveServer serves whatever archives the test puts in it, counting the
+// requests so tests can tell when the cache was used.
+type archiveServer struct {
+	*httptest.Server
+	archives map[string][]byte
+	requests atomic.Int32
+}
+
+func makeArchiveServer(t *testing.T) *archiveServer {
+	as := &archiveServer{
+		archives: map[string][]byte{},
+	}
+	as.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.requests.Add(1)
+		contents, found := as.archives[r.URL.RequestURI()]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(contents)
+	}))
+	t.Cleanup(as.Close)
+	return as
+}
+
+func (as *archiveServer) uri(name string, arguments string) string {
+	return fmt.Sprintf("archive+%v/%v;%v", as.URL, name, arguments)
+}
+
+type archiveTest struct {
+	t         *testing.T
+	srcDir    string
+	component *testcommon.ResolveComponent
+}
+
+func makeArchiveTest(t *testing.T, cacheDir string) *archiveTest {
+	srcDir := path.Join(t.TempDir(), "src")
+	return &archiveTest{
+		t:      t,
+		srcDir: srcDir,
+		component: &testcommon.ResolveComponent{
+			SourceDir: srcDir,
+			Data: map[string][]string{
+				archiveCacheDirKey: {cacheDir},
+			},
+		},
+	}
+}
+
+func (at *archiveTest) checkout(uri string) error {
+	return at.checkoutWith(uri, CheckoutOptions{})
+}
+
+func (at *archiveTest) checkoutWith(uri string, options CheckoutOptions) error {
+	info, err := BuildScmInfo(uri)
+	if err != nil {
+		at.t.Fatalf("Unexpected error: %v", err)
+	}
+	info.Options = options
+	handler, err := GetHandler(info.Scheme)(at.component)
+	if err != nil {
+		at.t.Fatalf("Unexpected error: %v", err)
+	}
+	return handler.Checkout(info)
+}
+
+func (at *archiveTest) expectFile(name string, expected string) {
+	contents, err := os.ReadFile(path.Join(at.srcDir, name))
+	if err != nil {
+		at.t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(contents) != expected {
+		at.t.Fatalf("Unexpected contents of %v (%v)", name, string(contents))
+	}
+}
+
+func TestArchiveFormats(t *testing.T) {
+	server := makeArchiveServer(t)
+	for _, format := range []string{formatTarGz, formatTarXz, formatTarZst, formatZip} {
+		t.Run(format, func(t *testing.T) {
+			name := fmt.Sprintf("foo-1.0.%v", format)
+			contents := buildArchive(t, format, []archiveEntry{
+				{name: "foo-1.0/src/foo.c", contents: format},
+			})
+			server.archives["/"+name] = contents
+
+			at := makeArchiveTest(t, t.TempDir())
+			err := at.checkout(server.uri(name, fmt.Sprintf("sha256=%v;strip=1", sha256Hex(contents))))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			at.expectFile("src/foo.c", format)
+		})
+	}
+}
+
+func TestArchiveChecksumMismatch(t *testing.T) {
+	server := makeArchiveServer(t)
+	server.archives["/foo.tar.gz"] = buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+
+	at := makeArchiveTest(t, t.TempDir())
+	err := at.checkout(server.uri("foo.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex([]byte("something else")))))
+	if _, ok := err.(*checksumMismatchError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(at.srcDir); !os.IsNotExist(err) {
+		t.Fatalf("Source directory populated despite bad checksum (%v)", err)
+	}
+}
+
+func TestArchiveCached(t *testing.T) {
+	server := makeArchiveServer(t)
+	contents := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	server.archives["/foo.tar.gz"] = contents
+	uri := server.uri("foo.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(contents)))
+	cacheDir := t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		at := makeArchiveTest(t, cacheDir)
+		err := at.checkout(uri)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		at.expectFile("foo.c", "foo")
+	}
+	if requests := server.requests.Load(); requests != 1 {
+		t.Fatalf("Unexpected downloads: %v", requests)
+	}
+}
+
+func TestArchiveOffline(t *testing.T) {
+	server := makeArchiveServer(t)
+	contents := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	server.archives["/foo.tar.gz"] = contents
+	uri := server.uri("foo.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(contents)))
+	cacheDir := t.TempDir()
+	t.Setenv(dpl.OfflineEnv, "1")
+
+	at := makeArchiveTest(t, cacheDir)
+	err := at.checkout(uri)
+	if !errors.Is(err, dpl.ErrOffline) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Setenv(dpl.OfflineEnv, "0")
+	err = makeArchiveTest(t, cacheDir).checkout(uri)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Setenv(dpl.OfflineEnv, "1")
+	err = at.checkout(uri)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	at.expectFile("foo.c", "foo")
+	if requests := server.requests.Load(); requests != 1 {
+		t.Fatalf("Unexpected downloads: %v", requests)
+	}
+}
+
+func TestArchiveReextract(t *testing.T) {
+	server := makeArchiveServer(t)
+	first := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "first"},
+		{name: "old.c", contents: "old"},
+	})
+	second := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "second"},
+	})
+	server.archives["/foo-1.tar.gz"] = first
+	server.archives["/foo-2.tar.gz"] = second
+	at := makeArchiveTest(t, t.TempDir())
+
+	err := at.checkout(server.uri("foo-1.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(first))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// same checksum, so nothing should be touched
+	err = os.WriteFile(path.Join(at.srcDir, "foo.c"), []byte("local"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = at.checkout(server.uri("foo-1.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(first))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	at.expectFile("foo.c", "local")
+
+	// a new checksum would replace the tree, which needs --force while
+	// there are local changes
+	err = os.WriteFile(path.Join(at.srcDir, "new.c"), []byte("new"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = at.checkout(server.uri("foo-2.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(second))))
+	edits, ok := err.(*localEditsError)
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(edits.modified, []string{"foo.c"}) || !reflect.DeepEqual(edits.untracked, []string{"new.c"}) {
+		t.Fatalf("Unexpected local changes (%v, %v)", edits.modified, edits.untracked)
+	}
+	at.expectFile("foo.c", "local")
+
+	err = at.checkoutWith(server.uri("foo-2.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(second))), CheckoutOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	at.expectFile("foo.c", "second")
+	if _, err := os.Stat(path.Join(at.srcDir, "old.c")); !os.IsNotExist(err) {
+		t.Fatalf("Stale file left behind (%v)", err)
+	}
+}
+
+func TestArchiveFile(t *testing.T) {
+	contents := buildArchive(t, formatZip, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	filename := path.Join(t.TempDir(), "foo.zip")
+	err := os.WriteFile(filename, contents, 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	at := makeArchiveTest(t, t.TempDir())
+	err = at.checkout(fmt.Sprintf("archive+file://%v;sha256=%v", filename, sha256Hex(contents)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	at.expectFile("foo.c", "foo")
+}
+
+func TestArchiveQuery(t *testing.T) {
+	server := makeArchiveServer(t)
+	contents := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	server.archives["/foo.tar.gz?token=abc"] = contents
+
+	at := makeArchiveTest(t, t.TempDir())
+	err := at.checkout(fmt.Sprintf("archive+%v/foo.tar.gz?token=abc;sha256=%v", server.URL, sha256Hex(contents)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	at.expectFile("foo.c", "foo")
+}
+
+func TestArchivePathOutside(t *testing.T) {
+	server := makeArchiveServer(t)
+	contents := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	server.archives["/foo.tar.gz"] = contents
+
+	for _, offset := range []string{"../elsewhere", "/tmp/elsewhere", "sub/../../elsewhere"} {
+		at := makeArchiveTest(t, t.TempDir())
+		err := at.checkout(server.uri("foo.tar.gz", fmt.Sprintf("sha256=%v;path=%v", sha256Hex(contents), offset)))
+		if err == nil {
+			t.Fatalf("Expected error for %v", offset)
+		}
+	}
+}
+
+func TestArchiveRefusesForeignDir(t *testing.T) {
+	server := makeArchiveServer(t)
+	contents := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	server.archives["/foo.tar.gz"] = contents
+	at := makeArchiveTest(t, t.TempDir())
+	err := os.MkdirAll(at.srcDir, 0755)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(path.Join(at.srcDir, "mine.c"), []byte("mine"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = at.checkout(server.uri("foo.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(contents))))
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	at.expectFile("mine.c", "mine")
+}
+
+func TestArchivePathTraversal(t *testing.T) {
+	tests := map[string][]archiveEntry{
+		"parent": {
+			{name: "../evil.c", contents: "evil"},
+		},
+		"absolute": {
+			{name: "/tmp/evil.c", contents: "evil"},
+		},
+		"symlink": {
+			{name: "link", linkname: "../../outside"},
+		},
+		"through-symlink": {
+			{name: "link", linkname: "."},
+			{name: "link/evil.c", contents: "evil"},
+		},
+		"symlink-chain": {
+			{name: "sub/a", linkname: "."},
+			{name: "sub/x", linkname: "a/../.."},
+			{name: "h", linkname: "sub/x/secret", hardlink: true},
+		},
+		"hardlink-through-symlink": {
+			{name: "sub/secret", contents: "secret"},
+			{name: "sub/a", linkname: "."},
+			{name: "h", linkname: "sub/a/secret", hardlink: true},
+		},
+		"hardlink-outside": {
+			{name: "h", linkname: "../secret", hardlink: true},
+		},
+	}
+	server := makeArchiveServer(t)
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			filename := fmt.Sprintf("%v.tar.gz", name)
+			contents := buildArchive(t, formatTarGz, entries)
+			server.archives["/"+filename] = contents
+
+			at := makeArchiveTest(t, t.TempDir())
+			err := at.checkout(server.uri(filename, fmt.Sprintf("sha256=%v", sha256Hex(contents))))
+			if _, ok := err.(*unsafePathError); !ok {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveLocked(t *testing.T) {
+	server := makeArchiveServer(t)
+	contents := buildArchive(t, formatTarGz, []archiveEntry{
+		{name: "foo.c", contents: "foo"},
+	})
+	server.archives["/foo.tar.gz"] = contents
+	at := makeArchiveTest(t, t.TempDir())
+	info, err := BuildScmInfo(server.uri("foo.tar.gz", fmt.Sprintf("sha256=%v", sha256Hex(contents))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler, err := makeArchive(at.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info.Options.Revision = "sha256:" + sha256Hex([]byte("something else"))
+	err = handler.Checkout(info)
+	if _, ok := err.(*checksumMismatchError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info.Options.Revision = "sha256:" + sha256Hex(contents)
+	err = handler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := handler.(StatusScmHandler).Status(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Commit != info.Options.Revision || !status.MatchesRef {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
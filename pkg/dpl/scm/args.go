@@ -2,8 +2,17 @@ package scm
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	// configure records the directory holding build.config here
+	configDirKey string = "dpl.config_dir"
 )
 
 var (
@@ -33,9 +42,37 @@ func extractArguments(raw string, separator string) (string, map[string]string,
 	return chunks[0], args, nil
 }
 
+// ContainedPath reports whether a relative path from an scm argument stays
+// inside the directory it's relative to.  Any .. is rejected, even if the
+// path would come back inside.
+func ContainedPath(raw string) bool {
+	if path.IsAbs(raw) {
+		return false
+	}
+	for _, part := range strings.Split(raw, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// configRelativePath resolves a path from a component's configuration.
+// Relative paths start from the directory holding build.config.
+func configRelativePath(component dpl.Component, p string) (string, error) {
+	if path.IsAbs(p) {
+		return path.Clean(p), nil
+	}
+	configDir, err := dpl.GetSingleComponentValue(component, configDirKey)
+	if err != nil {
+		return filepath.Abs(p)
+	}
+	return path.Join(configDir, p), nil
+}
+
 func init() {
 	var err error
-	argumentPattern, err = regexp.Compile(`(.+)=(.+)`)
+	argumentPattern, err = regexp.Compile(`([^=]+)=(.+)`)
 	if err != nil {
 		panic(err)
 	}
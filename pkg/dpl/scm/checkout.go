@@ -9,38 +9,105 @@ import (
 )
 
 const (
-	scmUriKey string = "scm.uri"
+	scmUriKey    string = "scm.uri"
+	scmUpdateKey string = "scm.update"
 )
 
 var (
+	checkoutOptions CheckoutOptions
+
 	CheckoutTask = common.Task{
 		Name: "scm",
 		Work: checkout,
 	}
 )
 
+// getUpdatePolicy picks the update policy for component.  A policy given on
+// the command line overrides the component's configuration.
+func getUpdatePolicy(component dpl.Component) (string, error) {
+	policy := checkoutOptions.Update
+	if len(policy) == 0 {
+		var err error
+		policy, err = dpl.GetSingleComponentValueOrDefault(component, scmUpdateKey, UpdateFastForward)
+		if err != nil {
+			return "", err
+		}
+	}
+	switch policy {
+	case UpdateNever, UpdateFetch, UpdateFastForward, UpdateReset:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid update policy '%v'", policy)
+}
+
+func buildScmInfos(scmUris []string) ([]ScmInfo, error) {
+	scmInfos := []ScmInfo{}
+	for _, uri := range scmUris {
+		scmInfo, err := BuildScmInfo(uri)
+		if err != nil {
+			return nil, err
+		}
+		scmInfos = append(scmInfos, scmInfo)
+	}
+	return scmInfos, nil
+}
+
 func checkout(component dpl.Component) error {
 	scmUris, err := component.ExpandValues(scmUriKey)
 	if err != nil {
 		return err
 	}
-	for _, uri := range scmUris {
-		scmInfo, err := BuildScmInfo(uri)
+	options := checkoutOptions
+	options.Update, err = getUpdatePolicy(component)
+	if err != nil {
+		return err
+	}
+	scmInfos, err := buildScmInfos(scmUris)
+	if err != nil {
+		return err
+	}
+	for i := range scmInfos {
+		scmInfos[i].Options = options
+	}
+	groups := groupScmInfos(scmInfos)
+	if checkoutLocked {
+		err = applyLock(component, scmUris, groups)
+		if err != nil {
+			return err
+		}
+	}
+	patched := false
+	if len(importArchive) == 0 {
+		patched, err = patchesCurrent(component, groups, options)
 		if err != nil {
 			return err
 		}
-		scmBuilder := GetHandler(scmInfo.Scheme)
-		if scmBuilder == nil {
-			return fmt.Errorf("no handler for %v", scmInfo.Scheme)
+	}
+	if !patched {
+		target, err := getPatchTarget(component)
+		if err != nil {
+			return err
 		}
-		handler, err := scmBuilder(component)
+		err = revertPatches(target)
 		if err != nil {
 			return err
 		}
-		err = handler.Checkout(scmInfo)
+	}
+	if len(importArchive) > 0 {
+		err = importComponent(component, scmUris, importArchive)
 		if err != nil {
 			return err
 		}
+		return applyPatches(component, groups)
+	}
+	for _, group := range groups {
+		err = checkoutGroup(component, group)
+		if err != nil {
+			return err
+		}
+	}
+	if patched {
+		return nil
 	}
-	return nil
+	return applyPatches(component, groups)
 }
@@ -79,3 +79,45 @@ func init() {
 		log.Fatalf("Error: %v", err)
 	}
 }
+
+func TestUpdatePolicyDefault(t *testing.T) {
+	c := &testcommon.ResolveComponent{}
+	policy, err := getUpdatePolicy(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if policy != UpdateFastForward {
+		t.Fatalf("Unexpected policy (%v)", policy)
+	}
+}
+
+func TestUpdatePolicyOverride(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		Data: map[string][]string{
+			scmUpdateKey: {UpdateFetch},
+		},
+	}
+	checkoutOptions.Update = UpdateReset
+	defer func() {
+		checkoutOptions.Update = ""
+	}()
+	policy, err := getUpdatePolicy(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if policy != UpdateReset {
+		t.Fatalf("Unexpected policy (%v)", policy)
+	}
+}
+
+func TestUpdatePolicyInvalid(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		Data: map[string][]string{
+			scmUpdateKey: {"sometimes"},
+		},
+	}
+	_, err := getUpdatePolicy(c)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
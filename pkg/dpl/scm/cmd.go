@@ -24,7 +24,25 @@ func doCheckout(cmd *cobra.Command, components []string) error {
 	})
 }
 
+// AddCheckoutFlags adds the flags that control how existing checkouts are
+// treated.  Any command that runs CheckoutTask should use it.
+func AddCheckoutFlags(command *cobra.Command) {
+	command.Flags().BoolVar(&checkoutOptions.Force, "force", false,
+		"Discard local changes in existing checkouts")
+	command.Flags().BoolVar(&checkoutOptions.Stash, "stash", false,
+		"Stash local changes in existing checkouts before updating them")
+	command.Flags().StringVar(&checkoutOptions.Update, "update", "",
+		"How to update existing checkouts (never, fetch, ff-only, or reset); overrides scm.update")
+	command.Flags().BoolVar(&checkoutLocked, "locked", false,
+		"Check out the revisions recorded in build.lock")
+	command.Flags().StringVar(&importArchive, "from", "",
+		"Populate source directories from an archive made by export-sources instead of the network")
+	command.MarkFlagsMutuallyExclusive("force", "stash")
+	command.MarkFlagsMutuallyExclusive("locked", "from")
+}
+
 func init() {
 	icmd.AddCommonArgs(checkoutCmd, &args)
+	AddCheckoutFlags(checkoutCmd)
 	cmd.AddCommand(checkoutCmd)
 }
@@ -0,0 +1,335 @@
+package scm
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+	icmd "github.com/dev-pipeline/dpl-go/internal/cmd"
+	"github.com/dev-pipeline/dpl-go/internal/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	exportManifestName string = "manifest.json"
+	exportSourcesDir   string = "sources"
+	exportVersion      int    = 1
+)
+
+type exportFlags struct {
+	Output string
+}
+
+// exportedComponent is what the manifest records about each component.
+// Revisions follow the same rules as the lock file.
+type exportedComponent struct {
+	URIs      []string `json:"uris"`
+	Revisions []string `json:"revisions"`
+}
+
+type exportManifest struct {
+	Version    int                          `json:"version"`
+	Components map[string]exportedComponent `json:"components"`
+}
+
+var (
+	scmExportFlags exportFlags
+	exportCommon   common.Args
+
+	exportCmd = &cobra.Command{
+		Use:   "export-sources [components]",
+		Short: "Package source trees for checking out without network access",
+		RunE:  doExport,
+	}
+)
+
+func exportComponentDir(name string) string {
+	return path.Join(exportSourcesDir, name)
+}
+
+// exportTree writes everything under srcDir into the archive below prefix.
+// Repositories are left out; only the checked out files are exported.  A
+// symlinked srcDir (e.g., a local source) is exported as what it points at.
+func exportTree(w *tar.Writer, srcDir string, prefix string) error {
+	srcDir, err := filepath.EvalSymlinks(srcDir)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(srcDir, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Name() == ".git" {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, filename)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return exportEntry(w, filename, info, path.Join(prefix, filepath.ToSlash(rel)))
+	})
+}
+
+func exportEntry(w *tar.Writer, filename string, info fs.FileInfo, name string) error {
+	linkname := ""
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		var err error
+		linkname, err = os.Readlink(filename)
+		if err != nil {
+			return err
+		}
+
+	case !info.IsDir() && !info.Mode().IsRegular():
+		// the extractor would skip these anyway
+		return nil
+	}
+	header, err := tar.FileInfoHeader(info, linkname)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	err = w.WriteHeader(header)
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// runExportGit runs git in dir, which has to be inside repoDir.
+func runExportGit(dir string, repoDir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// don't let git find the project's own repository instead
+	cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_CEILING_DIRECTORIES=%v", path.Dir(repoDir)))
+	return cmd
+}
+
+// committedSubmodules lists the submodules below dir, relative to it.
+func committedSubmodules(dir string, repoDir string) ([]string, error) {
+	output, err := runExportGit(dir, repoDir, "ls-files", "--stage", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("can't list files in %v (%w)", dir, err)
+	}
+	submodules := []string{}
+	for _, line := range strings.Split(string(output), "\x00") {
+		stage, name, found := strings.Cut(line, "\t")
+		if found && strings.HasPrefix(stage, "160000 ") {
+			submodules = append(submodules, name)
+		}
+	}
+	return submodules, nil
+}
+
+// exportCommitted writes the committed tree of the repository srcDir is
+// checked out from, so the archive matches the revisions in the manifest.
+// Local edits and untracked files (e.g., build artifacts) are left out, as
+// is anything a sparse checkout skipped.  Patches aren't committed either;
+// the importing checkout applies its own.
+func exportCommitted(w *tar.Writer, srcDir string, repoDir string, prefix string) error {
+	cmd := runExportGit(srcDir, repoDir, "archive", "--format=tar", "HEAD")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	err = copyCommitted(w, tar.NewReader(stdout), srcDir, prefix)
+	// drain whatever's left, so git isn't stuck writing it
+	io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+	if waitErr != nil {
+		return fmt.Errorf("can't export %v (%v: %v)", srcDir, waitErr, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return err
+	}
+	submodules, err := committedSubmodules(srcDir, repoDir)
+	if err != nil {
+		return err
+	}
+	for _, submodule := range submodules {
+		subDir := path.Join(srcDir, submodule)
+		if _, err := os.Stat(path.Join(subDir, ".git")); err != nil {
+			// not initialized, so there's nothing checked out to export
+			continue
+		}
+		err = exportCommitted(w, subDir, subDir, path.Join(prefix, submodule))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyCommitted(w *tar.Writer, r *tar.Reader, srcDir string, prefix string) error {
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			// git archive records the commit here; the manifest has it
+			continue
+		}
+		name := path.Clean(header.Name)
+		if _, err := os.Lstat(path.Join(srcDir, name)); err != nil {
+			continue
+		}
+		header.Name = path.Join(prefix, name)
+		if header.Typeflag == tar.TypeDir {
+			header.Name += "/"
+		}
+		err = w.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// exportComponent writes component's source tree below prefix.  Sources with
+// a repository of their own are exported as committed; anything else as it
+// is on disk.
+func exportComponent(w *tar.Writer, component dpl.Component, prefix string) error {
+	target, err := getPatchTarget(component)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path.Join(target.repoDir, ".git")); err == nil {
+		return exportCommitted(w, component.GetSourceDir(), target.repoDir, prefix)
+	}
+	return exportTree(w, component.GetSourceDir(), prefix)
+}
+
+func writeExportManifest(w *tar.Writer, manifest exportManifest) error {
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	contents = append(contents, '\n')
+	err = w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     exportManifestName,
+		Mode:     0644,
+		Size:     int64(len(contents)),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	return err
+}
+
+// exportSources writes the named components' source trees to output.  The
+// manifest goes first so importing doesn't have to read the whole archive to
+// find it.
+func exportSources(project dpl.Project, components []string, output string) error {
+	manifest := exportManifest{
+		Version:    exportVersion,
+		Components: map[string]exportedComponent{},
+	}
+	for _, name := range components {
+		component, err := project.GetComponent(name)
+		if err != nil {
+			return err
+		}
+		entry, err := lockComponent(component)
+		if err != nil {
+			return err
+		}
+		manifest.Components[name] = exportedComponent{
+			URIs:      entry.URIs,
+			Revisions: entry.Revisions,
+		}
+	}
+
+	scratch, err := os.CreateTemp(path.Dir(output), ".dpl-export-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(scratch.Name())
+	defer scratch.Close()
+	w := tar.NewWriter(scratch)
+	err = writeExportManifest(w, manifest)
+	if err != nil {
+		return err
+	}
+	for _, name := range components {
+		component, err := project.GetComponent(name)
+		if err != nil {
+			return err
+		}
+		err = exportComponent(w, component, exportComponentDir(name))
+		if err != nil {
+			return err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	err = scratch.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(scratch.Name(), output)
+}
+
+func doExport(cmd *cobra.Command, components []string) error {
+	project, components, err := common.LoadComponents(components, exportCommon)
+	if err != nil {
+		return err
+	}
+	err = exportSources(project, components, scmExportFlags.Output)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %v components to %v", len(components), scmExportFlags.Output)
+	return nil
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&scmExportFlags.Output, "output", "o", "sources.tar",
+		"Where to write the archive")
+	icmd.AddSelectionArgs(exportCmd, &exportCommon)
+	cmd.AddCommand(exportCmd)
+}
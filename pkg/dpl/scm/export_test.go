@@ -0,0 +1,256 @@
+package scm
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func runTestGit(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=dpl", "-c", "user.email=dpl@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (%v)", err, string(output))
+	}
+}
+
+// commitTestRepo makes dir a repository with everything in it committed.
+func commitTestRepo(t *testing.T, dir string) {
+	runTestGit(t, dir, "init", "--quiet")
+	runTestGit(t, dir, "add", "--all")
+	runTestGit(t, dir, "commit", "--quiet", "--message", "initial")
+}
+
+func makeExportProject(t *testing.T) (*testcommon.ResolveProject, string) {
+	srcDir := path.Join(t.TempDir(), "foo")
+	for filename, contents := range map[string]string{
+		"foo.c":          fooSource,
+		"include/foo.h":  "int foo();\n",
+		"sub/README.txt": "sub\n",
+	} {
+		writeTestFile(t, path.Join(srcDir, filename), contents)
+	}
+	err := os.Symlink("include/foo.h", path.Join(srcDir, "foo.h"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	commitTestRepo(t, path.Join(srcDir, "sub"))
+	commitTestRepo(t, srcDir)
+	// neither of these are committed, so neither should be exported
+	writeTestFile(t, path.Join(srcDir, "foo.c"), "edited")
+	writeTestFile(t, path.Join(srcDir, "foo.o"), "built")
+	return &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": {
+				ComponentName: "foo",
+				SourceDir:     srcDir,
+				Data: map[string][]string{
+					scmUriKey: {"status://example.com/primary"},
+				},
+			},
+		},
+	}, srcDir
+}
+
+func writeTestFile(t *testing.T, filename string, contents string) {
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func exportTestProject(t *testing.T, project *testcommon.ResolveProject) string {
+	output := path.Join(t.TempDir(), "sources.tar")
+	err := exportSources(project, []string{"foo"}, output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return output
+}
+
+func importTarget(t *testing.T, uri string) *testcommon.ResolveComponent {
+	return &testcommon.ResolveComponent{
+		ComponentName: "foo",
+		SourceDir:     path.Join(t.TempDir(), "src"),
+		Data: map[string][]string{
+			scmUriKey: {uri},
+		},
+	}
+}
+
+func TestExportManifest(t *testing.T) {
+	project, _ := makeExportProject(t)
+	manifest, err := readExportManifest(exportTestProject(t, project))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	foo, found := manifest.Components["foo"]
+	if !found || len(foo.Revisions) != 1 || foo.Revisions[0] != "0123456789abcdef0123456789abcdef01234567" {
+		t.Fatalf("Unexpected manifest: %+v", manifest)
+	}
+}
+
+func TestImport(t *testing.T) {
+	project, _ := makeExportProject(t)
+	archive := exportTestProject(t, project)
+	component := importTarget(t, "status://example.com/primary")
+	err := importComponent(component, component.Data[scmUriKey], archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for filename, expected := range map[string]string{
+		"foo.h":          "int foo();\n",
+		"foo.c":          fooSource,
+		"sub/README.txt": "sub\n",
+	} {
+		contents, err := os.ReadFile(path.Join(component.SourceDir, filename))
+		if err != nil || string(contents) != expected {
+			t.Fatalf("Unexpected %v (%v): %v", filename, err, string(contents))
+		}
+	}
+	for _, unwanted := range []string{".git", "sub/.git", "foo.o"} {
+		if _, err := os.Lstat(path.Join(component.SourceDir, unwanted)); !os.IsNotExist(err) {
+			t.Fatalf("%v was exported (%v)", unwanted, err)
+		}
+	}
+
+	// importing again is a no-op, even over local changes
+	writeTestFile(t, path.Join(component.SourceDir, "foo.c"), "changed")
+	err = importComponent(component, component.Data[scmUriKey], archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, _ := os.ReadFile(path.Join(component.SourceDir, "foo.c"))
+	if string(contents) != "changed" {
+		t.Fatalf("Import replaced an up to date tree")
+	}
+
+	// a different import would replace the tree, so the change has to be
+	// discarded explicitly
+	writeTestFile(t, path.Join(component.SourceDir, importMarker), "older")
+	err = importComponent(component, component.Data[scmUriKey], archive)
+	if _, ok := err.(*localEditsError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkoutOptions.Force = true
+	defer func() {
+		checkoutOptions.Force = false
+	}()
+	err = importComponent(component, component.Data[scmUriKey], archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	contents, _ = os.ReadFile(path.Join(component.SourceDir, "foo.c"))
+	if string(contents) == "changed" {
+		t.Fatalf("Forced import kept the local change")
+	}
+}
+
+func TestExportSymlinkedSource(t *testing.T) {
+	project, srcDir := makeExportProject(t)
+	// a local source in symlink mode; without a repository, it's exported
+	// as it is
+	err := os.RemoveAll(path.Join(srcDir, ".git"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	link := path.Join(t.TempDir(), "foo")
+	err = os.Symlink(srcDir, link)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	foo := project.Comps["foo"]
+	foo.SourceDir = link
+	project.Comps["foo"] = foo
+	archive := exportTestProject(t, project)
+
+	component := importTarget(t, "status://example.com/primary")
+	err = importComponent(component, component.Data[scmUriKey], archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := os.Lstat(component.SourceDir)
+	if err != nil || !info.IsDir() {
+		t.Fatalf("Unexpected source dir (%v): %v", err, info)
+	}
+	contents, err := os.ReadFile(path.Join(component.SourceDir, "foo.c"))
+	if err != nil || string(contents) != "edited" {
+		t.Fatalf("Unexpected contents (%v): %v", err, string(contents))
+	}
+}
+
+func TestImportNotEmpty(t *testing.T) {
+	project, _ := makeExportProject(t)
+	archive := exportTestProject(t, project)
+	component := importTarget(t, "status://example.com/primary")
+	writeTestFile(t, path.Join(component.SourceDir, "mine.txt"), "mine")
+	err := importComponent(component, component.Data[scmUriKey], archive)
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+}
+
+func TestImportStale(t *testing.T) {
+	project, _ := makeExportProject(t)
+	archive := exportTestProject(t, project)
+	component := importTarget(t, "status://example.com/other")
+	err := importComponent(component, component.Data[scmUriKey], archive)
+	var staleErr *staleExportError
+	if !errors.As(err, &staleErr) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestImportPatched(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "foo.patch", contents: fooPatch})
+	pt.component.ComponentName = "foo"
+	commitTestRepo(t, pt.srcDir)
+	err := checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	archive := exportTestProject(t, &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": *pt.component,
+		},
+	})
+
+	// the offline machine applies its own patches, which may differ
+	imported := makePatchTest(t,
+		patchFile{name: "foo.patch", contents: fooPatch},
+		patchFile{name: "bar.patch", contents: barPatch},
+	)
+	imported.component.ComponentName = "foo"
+	err = os.RemoveAll(imported.srcDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	importArchive = archive
+	defer func() {
+		importArchive = ""
+	}()
+	err = checkout(imported.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	imported.expectSource("int foo() {\n    bar();\n    return 1;\n}\n")
+
+	// this machine's patches aren't local changes, so a newer import can
+	// still replace the tree
+	writeTestFile(t, path.Join(imported.srcDir, importMarker), "older")
+	err = checkout(imported.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	imported.expectSource("int foo() {\n    bar();\n    return 1;\n}\n")
+}
@@ -0,0 +1,340 @@
+package scm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	formatTar    string = "tar"
+	formatTarGz  string = "tar.gz"
+	formatTarXz  string = "tar.xz"
+	formatTarZst string = "tar.zst"
+	formatZip    string = "zip"
+)
+
+var (
+	// suffixes are checked in order, so longer ones need to come first
+	formatSuffixes = []struct {
+		suffix string
+		format string
+	}{
+		{".tar.gz", formatTarGz},
+		{".tgz", formatTarGz},
+		{".tar.xz", formatTarXz},
+		{".txz", formatTarXz},
+		{".tar.zst", formatTarZst},
+		{".tzst", formatTarZst},
+		{".tar", formatTar},
+		{".zip", formatZip},
+	}
+)
+
+type unsafePathError struct {
+	name string
+}
+
+func (upe *unsafePathError) Error() string {
+	return fmt.Sprintf("refusing to extract '%v' outside the source directory", upe.name)
+}
+
+func guessFormat(filename string) (string, error) {
+	for _, candidate := range formatSuffixes {
+		if strings.HasSuffix(filename, candidate.suffix) {
+			return candidate.format, nil
+		}
+	}
+	return "", fmt.Errorf("can't tell the archive format of %v (use the format argument)", filename)
+}
+
+// isInside checks that a cleaned, slash-separated relative path stays within
+// the directory it's relative to.
+func isInside(rel string) bool {
+	return rel != ".." && !strings.HasPrefix(rel, "../") && !path.IsAbs(rel)
+}
+
+// archiveExtractor writes archive entries into dest.  Every entry is checked
+// to stay inside dest, including the targets of links, and nothing is ever
+// written through a symbolic link.
+type archiveExtractor struct {
+	dest  string
+	strip int
+	// if set, only entries under prefix are extracted, and prefix is
+	// removed from their names before stripping
+	prefix string
+}
+
+// target maps an entry name to its path relative to dest.  An empty result
+// means the entry was stripped away entirely.
+func (ae *archiveExtractor) target(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(name) || !isInside(cleaned) {
+		return "", &unsafePathError{name: name}
+	}
+	if len(ae.prefix) > 0 {
+		rel, found := strings.CutPrefix(cleaned, ae.prefix+"/")
+		if !found {
+			return "", nil
+		}
+		cleaned = rel
+	}
+	chunks := strings.Split(cleaned, "/")
+	if len(chunks) <= ae.strip || cleaned == "." {
+		return "", nil
+	}
+	return path.Join(chunks[ae.strip:]...), nil
+}
+
+func (ae *archiveExtractor) checkParents(rel string) error {
+	current := ae.dest
+	chunks := strings.Split(rel, "/")
+	for _, chunk := range chunks[:len(chunks)-1] {
+		current = path.Join(current, chunk)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return &unsafePathError{name: rel}
+		}
+	}
+	return nil
+}
+
+func (ae *archiveExtractor) prepare(name string) (string, error) {
+	rel, err := ae.target(name)
+	if err != nil || rel == "" {
+		return "", err
+	}
+	err = ae.checkParents(rel)
+	if err != nil {
+		return "", err
+	}
+	filename := path.Join(ae.dest, rel)
+	err = os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return "", err
+	}
+	// archives can list the same name twice; the last one wins
+	err = os.RemoveAll(filename)
+	if err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+func (ae *archiveExtractor) dir(name string) error {
+	rel, err := ae.target(name)
+	if err != nil || rel == "" {
+		return err
+	}
+	err = ae.checkParents(rel)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path.Join(ae.dest, rel), 0755)
+}
+
+func (ae *archiveExtractor) file(name string, mode os.FileMode, contents io.Reader) error {
+	filename, err := ae.prepare(name)
+	if err != nil || filename == "" {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, contents)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// climbsAfterDescending reports whether a link target has a .. after a
+// normal component (e.g., a/../..).  The kernel follows a before applying
+// the .., so if a is (or later becomes) a symbolic link the target isn't
+// where it looks like it is.
+func climbsAfterDescending(linkname string) bool {
+	descended := false
+	for _, chunk := range strings.Split(linkname, "/") {
+		switch chunk {
+		case "", ".":
+
+		case "..":
+			if descended {
+				return true
+			}
+
+		default:
+			descended = true
+		}
+	}
+	return false
+}
+
+func (ae *archiveExtractor) symlink(name string, linkname string) error {
+	rel, err := ae.target(name)
+	if err != nil || rel == "" {
+		return err
+	}
+	if path.IsAbs(linkname) || climbsAfterDescending(linkname) || !isInside(path.Join(path.Dir(rel), linkname)) {
+		return &unsafePathError{name: name}
+	}
+	filename, err := ae.prepare(name)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(linkname, filename)
+}
+
+func (ae *archiveExtractor) hardlink(name string, linkname string) error {
+	own, err := ae.target(name)
+	if err != nil || own == "" {
+		return err
+	}
+	rel, err := ae.target(linkname)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return &unsafePathError{name: name}
+	}
+	// os.Link follows symbolic links in the target's parents
+	err = ae.checkParents(rel)
+	if err != nil {
+		return &unsafePathError{name: name}
+	}
+	filename, err := ae.prepare(name)
+	if err != nil || filename == "" {
+		return err
+	}
+	return os.Link(path.Join(ae.dest, rel), filename)
+}
+
+func (ae *archiveExtractor) tar(r io.Reader) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = ae.dir(header.Name)
+
+		case tar.TypeReg:
+			err = ae.file(header.Name, header.FileInfo().Mode(), reader)
+
+		case tar.TypeSymlink:
+			err = ae.symlink(header.Name, header.Linkname)
+
+		case tar.TypeLink:
+			err = ae.hardlink(header.Name, header.Linkname)
+
+		default:
+			// devices, fifos, and the like have no place in a source tree
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (ae *archiveExtractor) zipEntry(entry *zip.File) error {
+	mode := entry.Mode()
+	if mode.IsDir() {
+		return ae.dir(entry.Name)
+	}
+	contents, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+	if mode&os.ModeSymlink != 0 {
+		linkname, err := io.ReadAll(contents)
+		if err != nil {
+			return err
+		}
+		return ae.symlink(entry.Name, string(linkname))
+	}
+	if !mode.IsRegular() {
+		return nil
+	}
+	return ae.file(entry.Name, mode, contents)
+}
+
+func (ae *archiveExtractor) zip(filename string) error {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, entry := range reader.File {
+		err = ae.zipEntry(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractArchive(filename string, format string, dest string, strip int) error {
+	extractor := &archiveExtractor{
+		dest:  dest,
+		strip: strip,
+	}
+	if format == formatZip {
+		return extractor.zip(filename)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch format {
+	case formatTar:
+		return extractor.tar(f)
+
+	case formatTarGz:
+		reader, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return extractor.tar(reader)
+
+	case formatTarXz:
+		reader, err := xz.NewReader(f)
+		if err != nil {
+			return err
+		}
+		return extractor.tar(reader)
+
+	case formatTarZst:
+		reader, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return extractor.tar(reader)
+	}
+	return fmt.Errorf("unsupported archive format '%v'", format)
+}
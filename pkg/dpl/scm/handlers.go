@@ -3,20 +3,98 @@ package scm
 import (
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl"
 )
 
+// Update policies for existing checkouts.
+const (
+	// UpdateNever leaves existing checkouts alone; only missing ones are
+	// checked out.
+	UpdateNever string = "never"
+	// UpdateFetch fetches new objects but doesn't move local branches.
+	UpdateFetch string = "fetch"
+	// UpdateFastForward moves local branches forward to match upstream.
+	UpdateFastForward string = "ff-only"
+	// UpdateReset moves local branches to match upstream, even if they've
+	// diverged.
+	UpdateReset string = "reset"
+)
+
+// CheckoutOptions controls what a handler may do to an existing checkout.
+// By default, handlers should refuse to throw away local work.
+type CheckoutOptions struct {
+	// Force discards local changes.
+	Force bool
+	// Stash saves local changes somewhere recoverable before checking out.
+	Stash bool
+	// Update is one of the Update policies.
+	Update string
+	// Revision, if set, is the exact revision recorded in the lock file.
+	// Handlers should check out exactly this or fail.
+	Revision string
+}
+
 type ScmInfo struct {
 	Scheme    string
 	Path      string
 	Arguments map[string]string
+	Options   CheckoutOptions
 }
 
+// ScmHandler populates a component's source directory.  When dpl.Offline()
+// is true, handlers must work from what's already local and return an error
+// wrapping dpl.ErrOffline if that isn't enough.
 type ScmHandler interface {
 	Checkout(ScmInfo) error
 }
 
+// SourceStatus describes a component's checkout.
+type SourceStatus struct {
+	// Missing is set when nothing has been checked out yet; nothing else
+	// is filled in.
+	Missing bool `json:"missing,omitempty"`
+	// Branch is empty when the checkout isn't on a branch.
+	Branch string `json:"branch,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Ref is the configured ref, if there is one.
+	Ref        string `json:"ref,omitempty"`
+	MatchesRef bool   `json:"matches_ref"`
+	// Upstream is empty when the branch doesn't track anything.
+	Upstream  string   `json:"upstream,omitempty"`
+	Ahead     int      `json:"ahead"`
+	Behind    int      `json:"behind"`
+	Modified  []string `json:"modified,omitempty"`
+	Untracked []string `json:"untracked,omitempty"`
+}
+
+// StatusScmHandler is implemented by handlers that can describe an existing
+// checkout without changing it.
+type StatusScmHandler interface {
+	ScmHandler
+	Status(ScmInfo) (*SourceStatus, error)
+}
+
+// UpstreamStatus compares a source with what its upstream has now.
+type UpstreamStatus struct {
+	// Current is the configured or locked revision, or what's checked out
+	// when the configuration follows a branch.
+	Current string `json:"current,omitempty"`
+	Latest  string `json:"latest,omitempty"`
+	// Outdated is set when Latest is newer than Current.
+	Outdated bool `json:"outdated"`
+	// Behind is nil when it can't be worked out without fetching.
+	Behind *int `json:"behind,omitempty"`
+}
+
+// UpstreamScmHandler is implemented by handlers that can check for newer
+// upstream revisions without changing anything locally.
+type UpstreamScmHandler interface {
+	ScmHandler
+	Upstream(ScmInfo) (*UpstreamStatus, error)
+}
+
 type MakeScm func(dpl.Component) (ScmHandler, error)
 
 var (
@@ -28,11 +106,16 @@ func AddHandler(protocol string, handler MakeScm) error {
 	return nil
 }
 
+// GetHandler finds the handler for protocol.  Compound schemes like
+// archive+https fall back to the handler for the part before the plus.
 func GetHandler(protocol string) MakeScm {
 	handler, found := scms[protocol]
 	if found {
 		return handler
 	}
+	if prefix, _, found := strings.Cut(protocol, "+"); found {
+		return scms[prefix]
+	}
 	return nil
 }
 
@@ -48,6 +131,20 @@ func BuildScmInfo(uriInfo string) (ScmInfo, error) {
 		return scmInfo, err
 	}
 
+	if len(uri.RawQuery) > 0 {
+		// arguments after a query string end up in it
+		query, queryArguments, err := extractArguments(uri.RawQuery, ";")
+		if err != nil {
+			return scmInfo, err
+		}
+		for k, v := range queryArguments {
+			arguments[k] = v
+		}
+		if len(query) > 0 {
+			trimmedPath = fmt.Sprintf("%v?%v", trimmedPath, query)
+		}
+	}
+
 	userPrefix := ""
 	if uri.User != nil {
 		userPrefix = fmt.Sprintf("%v@", uri.User)
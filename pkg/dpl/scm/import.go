@@ -0,0 +1,125 @@
+package scm
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/lockfile"
+)
+
+const (
+	// records which export a source directory was populated from
+	importMarker string = ".dpl-import"
+)
+
+type staleExportError struct {
+	component string
+	archive   string
+}
+
+func (see *staleExportError) Error() string {
+	return fmt.Sprintf("%v was exported to %v with a different scm.uri", see.component, see.archive)
+}
+
+var (
+	// importArchive, if set, is an export-sources archive to check out
+	// from instead of the network.
+	importArchive string
+)
+
+func readExportManifest(archive string) (exportManifest, error) {
+	manifest := exportManifest{}
+	f, err := os.Open(archive)
+	if err != nil {
+		return manifest, err
+	}
+	defer f.Close()
+	reader := tar.NewReader(f)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return manifest, fmt.Errorf("%v has no %v", archive, exportManifestName)
+		}
+		if err != nil {
+			return manifest, err
+		}
+		if header.Name != exportManifestName {
+			continue
+		}
+		err = json.NewDecoder(reader).Decode(&manifest)
+		if err != nil {
+			return manifest, err
+		}
+		if manifest.Version != exportVersion {
+			return manifest, fmt.Errorf("%v has unsupported version %v", archive, manifest.Version)
+		}
+		return manifest, nil
+	}
+}
+
+// importComponent populates component's source directory from an export.
+// Like archives, a directory that wasn't imported is only replaced with
+// --force, and one imported from the same revisions is left alone.
+func importComponent(component dpl.Component, scmUris []string, archive string) error {
+	manifest, err := readExportManifest(archive)
+	if err != nil {
+		return err
+	}
+	exported, found := manifest.Components[component.Name()]
+	if !found {
+		return fmt.Errorf("%v isn't in %v", component.Name(), archive)
+	}
+	entry := lockfile.Entry{
+		URIs:      exported.URIs,
+		Revisions: exported.Revisions,
+	}
+	if !entry.Matches(scmUris) {
+		return &staleExportError{
+			component: component.Name(),
+			archive:   archive,
+		}
+	}
+
+	srcDir := component.GetSourceDir()
+	source := strings.Join(exported.Revisions, " ")
+	previous := readMarker(srcDir, importMarker)
+	if previous == source {
+		return nil
+	}
+	if len(previous) == 0 && !checkoutOptions.Force {
+		entries, err := os.ReadDir(srcDir)
+		if err == nil && len(entries) > 0 {
+			return fmt.Errorf("%v isn't empty and wasn't imported (use --force to replace it)", srcDir)
+		}
+	}
+	err = replaceSourceDir(srcDir, importMarker, source, checkoutOptions.Force, func(dest string) error {
+		f, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		extractor := &archiveExtractor{
+			dest:   dest,
+			prefix: exportComponentDir(component.Name()),
+		}
+		err = extractor.tar(f)
+		if err != nil {
+			return err
+		}
+		// the export has the exporting machine's patches applied; take them
+		// back out so this machine's scm.patches apply cleanly (and so the
+		// manifest describes the tree the next import will compare against)
+		return revertPatches(patchTarget{repoDir: dest})
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%v: imported from %v", component.Name(), archive)
+	return nil
+}
@@ -0,0 +1,358 @@
+package scm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	localModeArg string = "mode"
+
+	// the source directory is a symlink to the local path
+	localModeSymlink string = "symlink"
+	// files are copied over the source directory, skipping unchanged ones
+	localModeCopy string = "copy"
+	// like copy, but files that disappeared from the local path are removed
+	localModeRsync string = "rsync"
+
+	// records which local path a copied source directory was synced from
+	localMarker string = ".dpl-local"
+)
+
+func getLocalMode(info ScmInfo) (string, error) {
+	mode, found := info.Arguments[localModeArg]
+	if !found {
+		return localModeSymlink, nil
+	}
+	switch mode {
+	case localModeSymlink, localModeCopy, localModeRsync:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid local mode '%v'", mode)
+}
+
+func hashLocalFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// sameFile decides whether dest already matches src.  Matching size and
+// modification time is trusted; otherwise the contents are compared.
+func sameFile(src string, srcInfo fs.FileInfo, dest string) (bool, error) {
+	destInfo, err := os.Lstat(dest)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !destInfo.Mode().IsRegular() || destInfo.Mode().Perm() != srcInfo.Mode().Perm() || destInfo.Size() != srcInfo.Size() {
+		return false, nil
+	}
+	if destInfo.ModTime().Equal(srcInfo.ModTime()) {
+		return true, nil
+	}
+	srcHash, err := hashLocalFile(src)
+	if err != nil {
+		return false, err
+	}
+	destHash, err := hashLocalFile(dest)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(srcHash, destHash) {
+		return false, nil
+	}
+	// same contents; bring the timestamp along so the next sync is cheap
+	return true, os.Chtimes(dest, srcInfo.ModTime(), srcInfo.ModTime())
+}
+
+func copyLocalFile(src string, srcInfo fs.FileInfo, dest string) error {
+	same, err := sameFile(src, srcInfo, dest)
+	if err != nil || same {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, srcInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dest, srcInfo.ModTime(), srcInfo.ModTime())
+}
+
+func copyLocalSymlink(src string, dest string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.Readlink(dest); err == nil && existing == target {
+		return nil
+	}
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dest)
+}
+
+// findSyncConflicts finds local changes in dest that a sync from src would
+// destroy.  Copying leaves files src doesn't have alone, so those only count
+// when pruning.
+func findSyncConflicts(src string, dest string, prune bool) error {
+	entries, err := os.ReadDir(dest)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(readMarker(dest, localMarker)) == 0 {
+		return fmt.Errorf("%v isn't empty and wasn't synced from a local path (use --force to replace it)", dest)
+	}
+	edits, err := findLocalEdits(dest, localMarker)
+	if err != nil || edits == nil {
+		return err
+	}
+	if !prune {
+		untracked := []string{}
+		for _, name := range edits.untracked {
+			if _, err := os.Lstat(path.Join(src, name)); err == nil {
+				untracked = append(untracked, name)
+			}
+		}
+		edits.untracked = untracked
+		if len(edits.modified) == 0 && len(edits.untracked) == 0 {
+			return nil
+		}
+	}
+	return edits
+}
+
+// syncLocalDir copies src over dest, skipping files that are already up to
+// date.  With prune set, anything in dest that isn't in src is removed.
+// Files changed in dest since the last sync are only replaced with force.
+func syncLocalDir(src string, dest string, prune bool, force bool) error {
+	if !force {
+		err := findSyncConflicts(src, dest, prune)
+		if err != nil {
+			return err
+		}
+	}
+	seen := map[string]bool{
+		localMarker:                  true,
+		localMarker + manifestSuffix: true,
+	}
+	err := filepath.WalkDir(src, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, filename)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		target := path.Join(dest, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			existing, err := os.Lstat(target)
+			if err == nil && !existing.IsDir() {
+				err = os.Remove(target)
+				if err != nil {
+					return err
+				}
+			}
+			return os.MkdirAll(target, 0755)
+
+		case info.Mode()&os.ModeSymlink != 0:
+			return copyLocalSymlink(filename, target)
+
+		case info.Mode().IsRegular():
+			return copyLocalFile(filename, info, target)
+		}
+		// sockets and the like can't be copied
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if prune {
+		err = pruneLocalDir(dest, seen)
+		if err != nil {
+			return err
+		}
+	}
+	fingerprints, err := fingerprintTree(dest, localMarker, localMarker+manifestSuffix)
+	if err != nil {
+		return err
+	}
+	// files copying left alone aren't ours to track
+	for name := range fingerprints {
+		if !seen[filepath.FromSlash(name)] {
+			delete(fingerprints, name)
+		}
+	}
+	return writeMarker(dest, localMarker, src, fingerprints)
+}
+
+// pruneLocalDir removes anything in dest that wasn't seen in the source.
+func pruneLocalDir(dest string, seen map[string]bool) error {
+	stale := []string{}
+	err := filepath.WalkDir(dest, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dest, filename)
+		if err != nil {
+			return err
+		}
+		if !seen[rel] {
+			stale = append(stale, filename)
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, filename := range stale {
+		err = os.RemoveAll(filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func linkLocalDir(src string, dest string, force bool) error {
+	if existing, err := os.Readlink(dest); err == nil {
+		if existing == src {
+			return nil
+		}
+		// pointing somewhere else is fine to replace; nothing's lost
+		err = os.Remove(dest)
+		if err != nil {
+			return err
+		}
+	} else if entries, err := os.ReadDir(dest); err == nil {
+		if len(entries) > 0 && !force {
+			return fmt.Errorf("%v already exists (use --force to replace it with a symlink)", dest)
+		}
+		err = os.RemoveAll(dest)
+		if err != nil {
+			return err
+		}
+	}
+	err := os.MkdirAll(path.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(src, dest)
+}
+
+type localHandler struct {
+	component dpl.Component
+}
+
+func (lh *localHandler) Checkout(info ScmInfo) error {
+	mode, err := getLocalMode(info)
+	if err != nil {
+		return err
+	}
+	src, err := configRelativePath(lh.component, info.Path)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !srcInfo.IsDir() {
+		return fmt.Errorf("%v isn't a directory", src)
+	}
+	dest := lh.component.GetSourceDir()
+	if path.Clean(dest) == src {
+		// the component already lives where it's built from
+		return nil
+	}
+	if info.Options.Update == UpdateNever {
+		if _, err := os.Lstat(dest); err == nil {
+			return nil
+		}
+	}
+
+	switch mode {
+	case localModeCopy, localModeRsync:
+		if _, linkErr := os.Readlink(dest); linkErr == nil {
+			// switching from symlink mode; don't copy through the link
+			err = os.Remove(dest)
+			if err != nil {
+				return err
+			}
+		}
+		err = syncLocalDir(src, dest, mode == localModeRsync, info.Options.Force)
+
+	default:
+		err = linkLocalDir(src, dest, info.Options.Force)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%v: updated from %v (%v)", lh.component.Name(), src, mode)
+	return nil
+}
+
+func makeLocal(component dpl.Component) (ScmHandler, error) {
+	return &localHandler{
+		component: component,
+	}, nil
+}
+
+func init() {
+	for _, scheme := range []string{"local", "file"} {
+		err := AddHandler(scheme, makeLocal)
+		if err != nil {
+			log.Fatalf("Error registering %v handler: %v", scheme, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package scm
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+type localTest struct {
+	t         *testing.T
+	rootDir   string
+	srcDir    string
+	component *testcommon.ResolveComponent
+}
+
+func makeLocalTest(t *testing.T) *localTest {
+	rootDir := t.TempDir()
+	srcDir := path.Join(t.TempDir(), "src")
+	lt := &localTest{
+		t:       t,
+		rootDir: rootDir,
+		srcDir:  srcDir,
+		component: &testcommon.ResolveComponent{
+			SourceDir: srcDir,
+			Data: map[string][]string{
+				configDirKey: {rootDir},
+			},
+		},
+	}
+	lt.write("libs/foo/foo.c", "foo")
+	lt.write("libs/foo/include/foo.h", "header")
+	return lt
+}
+
+func (lt *localTest) write(name string, contents string) {
+	filename := path.Join(lt.rootDir, name)
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		lt.t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		lt.t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func (lt *localTest) checkout(uri string) error {
+	return lt.checkoutWith(uri, CheckoutOptions{})
+}
+
+func (lt *localTest) checkoutWith(uri string, options CheckoutOptions) error {
+	info, err := BuildScmInfo(uri)
+	if err != nil {
+		lt.t.Fatalf("Unexpected error: %v", err)
+	}
+	info.Options = options
+	handler, err := GetHandler(info.Scheme)(lt.component)
+	if err != nil {
+		lt.t.Fatalf("Unexpected error: %v", err)
+	}
+	return handler.Checkout(info)
+}
+
+func (lt *localTest) expectFile(name string, expected string) {
+	contents, err := os.ReadFile(path.Join(lt.srcDir, name))
+	if err != nil {
+		lt.t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(contents) != expected {
+		lt.t.Fatalf("Unexpected contents of %v (%v)", name, string(contents))
+	}
+}
+
+func TestLocalSymlink(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	target, err := os.Readlink(lt.srcDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target != path.Join(lt.rootDir, "libs", "foo") {
+		t.Fatalf("Unexpected link target (%v)", target)
+	}
+}
+
+func TestLocalSymlinkRefusesDir(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := os.MkdirAll(lt.srcDir, 0755)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(path.Join(lt.srcDir, "mine.c"), []byte("mine"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = lt.checkout("local://libs/foo")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	lt.expectFile("mine.c", "mine")
+}
+
+func TestLocalCopy(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("foo.c", "foo")
+	lt.expectFile("include/foo.h", "header")
+	if _, err := os.Readlink(lt.srcDir); err == nil {
+		t.Fatalf("Copy mode created a symlink")
+	}
+
+	// unchanged files keep their identity; changed ones are replaced
+	before, err := os.Stat(path.Join(lt.srcDir, "include", "foo.h"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.write("libs/foo/foo.c", "changed")
+	err = lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("foo.c", "changed")
+	after, err := os.Stat(path.Join(lt.srcDir, "include", "foo.h"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Fatalf("Unchanged file was copied again")
+	}
+}
+
+func TestLocalCopySameContents(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// a touched but identical file only needs its timestamp fixed
+	touched := time.Now().Add(time.Hour)
+	err = os.Chtimes(path.Join(lt.rootDir, "libs", "foo", "foo.c"), touched, touched)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	before, err := os.Stat(path.Join(lt.srcDir, "foo.c"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	after, err := os.Stat(path.Join(lt.srcDir, "foo.c"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !os.SameFile(before, after) || !after.ModTime().Equal(touched) {
+		t.Fatalf("Unexpected file update (%v)", after.ModTime())
+	}
+}
+
+func TestLocalRsyncPrunes(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo;mode=rsync")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.RemoveAll(path.Join(lt.rootDir, "libs", "foo", "include"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lt.checkout("local://libs/foo;mode=rsync")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("foo.c", "foo")
+	if _, err := os.Stat(path.Join(lt.srcDir, "include")); !os.IsNotExist(err) {
+		t.Fatalf("Stale directory left behind (%v)", err)
+	}
+}
+
+func TestLocalSameDir(t *testing.T) {
+	lt := makeLocalTest(t)
+	lt.component.SourceDir = path.Join(lt.rootDir, "libs", "foo")
+	err := lt.checkout("local://libs/foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := os.Lstat(lt.component.SourceDir)
+	if err != nil || !info.IsDir() {
+		t.Fatalf("Source directory was disturbed (%v)", err)
+	}
+}
+
+func TestLocalInvalidMode(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo;mode=bind")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
+
+func TestLocalCopyRefusesEdits(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(path.Join(lt.srcDir, "foo.c"), []byte("mine"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.write("libs/foo/foo.c", "changed")
+	err = lt.checkout("local://libs/foo;mode=copy")
+	if _, ok := err.(*localEditsError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("foo.c", "mine")
+
+	err = lt.checkoutWith("local://libs/foo;mode=copy", CheckoutOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("foo.c", "changed")
+}
+
+func TestLocalCopyKeepsOwnFiles(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// copying never touches files the local path doesn't have
+	err = os.WriteFile(path.Join(lt.srcDir, "build.log"), []byte("log"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lt.checkout("local://libs/foo;mode=copy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("build.log", "log")
+
+	// but pruning would delete it
+	err = lt.checkout("local://libs/foo;mode=rsync")
+	if _, ok := err.(*localEditsError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lt.expectFile("build.log", "log")
+}
+
+func TestLocalCopyRefusesForeignDir(t *testing.T) {
+	lt := makeLocalTest(t)
+	err := os.MkdirAll(lt.srcDir, 0755)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(path.Join(lt.srcDir, "foo.c"), []byte("mine"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lt.checkout("local://libs/foo;mode=copy")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	lt.expectFile("foo.c", "mine")
+}
@@ -0,0 +1,193 @@
+package scm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+	icmd "github.com/dev-pipeline/dpl-go/internal/cmd"
+	"github.com/dev-pipeline/dpl-go/internal/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/lockfile"
+)
+
+const (
+	// configure points every component at the lock file next to
+	// build.config
+	lockFileKey string = "dpl.lock_file"
+)
+
+type lockFlags struct {
+	Update bool
+}
+
+type staleLockError struct {
+	component string
+}
+
+func (sle *staleLockError) Error() string {
+	return fmt.Sprintf("lock file entry for %v doesn't match its scm.uri (run 'dpl lock --update %v')", sle.component, sle.component)
+}
+
+var (
+	scmLockFlags lockFlags
+	lockCommon   common.Args
+
+	// checkoutLocked checks out the revisions in the lock file instead of
+	// whatever the configured refs point at.
+	checkoutLocked bool
+
+	lockCmd = &cobra.Command{
+		Use:   "lock [components]",
+		Short: "Record the exact revision checked out for each component",
+		RunE:  doLock,
+	}
+)
+
+func getLockFile(component dpl.Component) (string, error) {
+	lockFile, err := dpl.GetSingleComponentValue(component, lockFileKey)
+	if err != nil {
+		return "", fmt.Errorf("%v has no lock file; reconfigure the project (%w)", component.Name(), err)
+	}
+	return lockFile, nil
+}
+
+// lockedRevisions finds the revisions to pin each scm.uri group to.
+func lockedRevisions(component dpl.Component, scmUris []string) ([]string, error) {
+	lockFile, err := getLockFile(component)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.Load(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	entry, found := lock[component.Name()]
+	if !found {
+		return nil, fmt.Errorf("%v isn't in %v (run 'dpl lock --update %v')", component.Name(), lockFile, component.Name())
+	}
+	if !entry.Matches(scmUris) {
+		return nil, &staleLockError{
+			component: component.Name(),
+		}
+	}
+	return entry.Revisions, nil
+}
+
+// applyLock pins each group to its locked revision.
+func applyLock(component dpl.Component, scmUris []string, groups []*scmGroup) error {
+	revisions, err := lockedRevisions(component, scmUris)
+	if err != nil {
+		return err
+	}
+	if len(revisions) != len(groups) {
+		return &staleLockError{
+			component: component.Name(),
+		}
+	}
+	for i, group := range groups {
+		if revisions[i] == lockfile.Unlocked {
+			continue
+		}
+		for j := range group.infos {
+			group.infos[j].Options.Revision = revisions[i]
+		}
+	}
+	return nil
+}
+
+// lockComponent records what's checked out for each of component's sources.
+// Sources whose handlers can't report status are left unlocked.
+func lockComponent(component dpl.Component) (lockfile.Entry, error) {
+	entry := lockfile.Entry{}
+	scmUris, err := component.ExpandValues(scmUriKey)
+	if err != nil {
+		return entry, err
+	}
+	scmInfos, err := buildScmInfos(scmUris)
+	if err != nil {
+		return entry, err
+	}
+	entry.URIs = scmUris
+	for _, group := range groupScmInfos(scmInfos) {
+		status, err := sourceStatus(component, group.infos[0])
+		if _, ok := err.(*noStatusError); ok {
+			log.Printf("%v: can't lock %v sources", component.Name(), group.infos[0].Scheme)
+			entry.Revisions = append(entry.Revisions, lockfile.Unlocked)
+			continue
+		}
+		if err != nil {
+			return entry, err
+		}
+		if status.Missing {
+			return entry, fmt.Errorf("%v isn't checked out", component.Name())
+		}
+		if len(status.Modified) > 0 {
+			log.Printf("%v: has local changes that won't be in the lock file", component.Name())
+		}
+		entry.Revisions = append(entry.Revisions, status.Commit)
+	}
+	return entry, nil
+}
+
+// lockProject locks the named components.  Without update, the lock file is
+// rebuilt from scratch; with it, other components' entries are kept.
+func lockProject(project dpl.Project, components []string, update bool) error {
+	if len(components) == 0 {
+		components = project.ComponentNames()
+	}
+	if len(components) == 0 {
+		return nil
+	}
+	first, err := project.GetComponent(components[0])
+	if err != nil {
+		return err
+	}
+	lockFile, err := getLockFile(first)
+	if err != nil {
+		return err
+	}
+	lock := lockfile.LockFile{}
+	if update {
+		lock, err = lockfile.Load(lockFile)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range components {
+		component, err := project.GetComponent(name)
+		if err != nil {
+			return err
+		}
+		lock[name], err = lockComponent(component)
+		if err != nil {
+			return err
+		}
+	}
+	err = lock.Write(lockFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Locked %v components in %v", len(components), lockFile)
+	return nil
+}
+
+func doLock(cmd *cobra.Command, components []string) error {
+	if len(components) > 0 && !scmLockFlags.Update {
+		return fmt.Errorf("use --update to lock specific components")
+	}
+	project, components, err := common.LoadComponents(components, lockCommon)
+	if err != nil {
+		return err
+	}
+	return lockProject(project, components, scmLockFlags.Update)
+}
+
+func init() {
+	lockCmd.Flags().BoolVar(&scmLockFlags.Update, "update", false,
+		"Only refresh the given components, keeping the rest of the lock file")
+	icmd.AddSelectionArgs(lockCmd, &lockCommon)
+	cmd.AddCommand(lockCmd)
+}
@@ -0,0 +1,131 @@
+package scm
+
+import (
+	"log"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/lockfile"
+)
+
+// recordScm remembers the revision each checkout was pinned to.
+type recordScm struct {
+	statusScm
+}
+
+var (
+	recordedRevisions = map[string]string{}
+)
+
+func (recordScm) Checkout(info ScmInfo) error {
+	recordedRevisions[info.Path] = info.Options.Revision
+	return nil
+}
+
+func makeRecordScm(dpl.Component) (ScmHandler, error) {
+	return &recordScm{}, nil
+}
+
+func makeLockProject(t *testing.T) (*testcommon.ResolveProject, string) {
+	lockFile := path.Join(t.TempDir(), lockfile.Filename)
+	component := func(name string, uris ...string) testcommon.ResolveComponent {
+		return testcommon.ResolveComponent{
+			ComponentName: name,
+			Data: map[string][]string{
+				scmUriKey:   uris,
+				lockFileKey: {lockFile},
+			},
+		}
+	}
+	return &testcommon.ResolveProject{
+		Comps: testcommon.ResolveComponents{
+			"foo": component("foo", "record://example.com/foo"),
+			"bar": component("bar", "record://example.com/bar", buildTestUri("unlockable")),
+		},
+	}, lockFile
+}
+
+func TestLock(t *testing.T) {
+	project, lockFile := makeLockProject(t)
+	err := lockProject(project, nil, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lock, err := lockfile.Load(lockFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	expected := lockfile.LockFile{
+		"foo": {
+			URIs:      []string{"record://example.com/foo"},
+			Revisions: []string{commit},
+		},
+		"bar": {
+			URIs:      []string{"record://example.com/bar", buildTestUri("unlockable")},
+			Revisions: []string{commit, lockfile.Unlocked},
+		},
+	}
+	if !reflect.DeepEqual(lock, expected) {
+		t.Fatalf("Unexpected lock file: %v", lock)
+	}
+
+	checkoutLocked = true
+	defer func() {
+		checkoutLocked = false
+	}()
+	for _, name := range []string{"foo", "bar"} {
+		component, _ := project.GetComponent(name)
+		err = checkout(component)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if recordedRevisions["example.com/"+name] != commit {
+			t.Fatalf("Unexpected revision: %v", recordedRevisions)
+		}
+	}
+}
+
+func TestLockUpdate(t *testing.T) {
+	project, lockFile := makeLockProject(t)
+	stale := lockfile.LockFile{
+		"foo": {URIs: []string{"record://example.com/old"}, Revisions: []string{"old"}},
+		"bar": {URIs: []string{"record://example.com/old"}, Revisions: []string{"old"}},
+	}
+	err := stale.Write(lockFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lockProject(project, []string{"foo"}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lock, err := lockfile.Load(lockFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(lock["bar"], stale["bar"]) || lock["foo"].URIs[0] != "record://example.com/foo" {
+		t.Fatalf("Unexpected lock file: %v", lock)
+	}
+
+	// bar's entry no longer matches its configuration
+	checkoutLocked = true
+	defer func() {
+		checkoutLocked = false
+	}()
+	component, _ := project.GetComponent("bar")
+	err = checkout(component)
+	if _, ok := err.(*staleLockError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func init() {
+	err := AddHandler("record", makeRecordScm)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
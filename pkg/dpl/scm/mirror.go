@@ -0,0 +1,132 @@
+package scm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	// scm.uri values sharing a mirror argument are alternate locations of the
+	// same source, tried in the order they're listed
+	mirrorArg string = "mirror"
+
+	scmTimeoutKey string = "scm.timeout"
+
+	// without a limit, a hung primary would never fall back to its mirrors
+	defaultMirrorTimeout string = "10m"
+)
+
+// ContextScmHandler is implemented by handlers that can give up on a checkout
+// when asked.  Only these handlers get a timeout per attempt; anything else is
+// left to finish (or fail) on its own, since abandoning it could leave it
+// writing into the source directory while the next mirror is tried.
+type ContextScmHandler interface {
+	ScmHandler
+	CheckoutContext(context.Context, ScmInfo) error
+}
+
+// scmGroup is a set of alternate locations for the same source.
+type scmGroup struct {
+	name  string
+	infos []ScmInfo
+}
+
+// groupScmInfos collects scm.uri values into groups, keeping the order the
+// groups were first seen in.  Values without a mirror argument are alone in
+// their group.
+func groupScmInfos(infos []ScmInfo) []*scmGroup {
+	groups := []*scmGroup{}
+	named := map[string]*scmGroup{}
+	for _, info := range infos {
+		name, found := info.Arguments[mirrorArg]
+		if !found {
+			groups = append(groups, &scmGroup{
+				infos: []ScmInfo{info},
+			})
+			continue
+		}
+		// the caller's infos share their argument maps
+		arguments := map[string]string{}
+		for k, v := range info.Arguments {
+			arguments[k] = v
+		}
+		delete(arguments, mirrorArg)
+		info.Arguments = arguments
+		group, found := named[name]
+		if !found {
+			group = &scmGroup{
+				name: name,
+			}
+			named[name] = group
+			groups = append(groups, group)
+		}
+		group.infos = append(group.infos, info)
+	}
+	return groups
+}
+
+func getScmTimeout(component dpl.Component, group *scmGroup) (time.Duration, error) {
+	fallback := "0"
+	if len(group.infos) > 1 {
+		fallback = defaultMirrorTimeout
+	}
+	raw, err := dpl.GetSingleComponentValueOrDefault(component, scmTimeoutKey, fallback)
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(raw)
+}
+
+func checkoutOne(component dpl.Component, info ScmInfo, timeout time.Duration) error {
+	scmBuilder := GetHandler(info.Scheme)
+	if scmBuilder == nil {
+		return fmt.Errorf("no handler for %v", info.Scheme)
+	}
+	handler, err := scmBuilder(component)
+	if err != nil {
+		return err
+	}
+	contextHandler, ok := handler.(ContextScmHandler)
+	if timeout <= 0 {
+		return handler.Checkout(info)
+	}
+	if !ok {
+		log.Printf("%v: %v checkouts can't be timed out, ignoring %v=%v", component.Name(), info.Scheme, scmTimeoutKey, timeout)
+		return handler.Checkout(info)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = contextHandler.CheckoutContext(ctx, info)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("timed out after %v: %w", timeout, err)
+	}
+	return err
+}
+
+// checkoutGroup tries each location in a group until one works.
+func checkoutGroup(component dpl.Component, group *scmGroup) error {
+	timeout, err := getScmTimeout(component, group)
+	if err != nil {
+		return err
+	}
+	if len(group.infos) == 1 {
+		return checkoutOne(component, group.infos[0], timeout)
+	}
+	errs := []error{}
+	for _, info := range group.infos {
+		location := fmt.Sprintf("%v://%v", info.Scheme, info.Path)
+		err := checkoutOne(component, info, timeout)
+		if err == nil {
+			log.Printf("%v: checked out %v from %v", component.Name(), group.name, location)
+			return nil
+		}
+		log.Printf("%v: couldn't check out %v from %v: %v", component.Name(), group.name, location, err)
+		errs = append(errs, fmt.Errorf("%v: %w", location, err))
+	}
+	return fmt.Errorf("all mirrors of %v failed: %w", group.name, errors.Join(errs...))
+}
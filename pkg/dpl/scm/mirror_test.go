@@ -0,0 +1,113 @@
+package scm
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+// slowScm never finishes on its own, so it only returns once it's cancelled.
+type slowScm struct {
+}
+
+func (slowScm) Checkout(ScmInfo) error {
+	return errTestCheckout
+}
+
+func (slowScm) CheckoutContext(ctx context.Context, info ScmInfo) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func makeSlowScm(dpl.Component) (ScmHandler, error) {
+	return &slowScm{}, nil
+}
+
+func TestGroupScmInfos(t *testing.T) {
+	infos := []ScmInfo{}
+	for _, uri := range []string{
+		"test://example.com/primary;mirror=foo",
+		"test://example.com/other",
+		"test://example.com/fallback;mirror=foo",
+	} {
+		info, err := BuildScmInfo(uri)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		infos = append(infos, info)
+	}
+
+	groups := groupScmInfos(infos)
+	if len(groups) != 2 {
+		t.Fatalf("Unexpected groups: %v", groups)
+	}
+	if len(groups[0].infos) != 2 || groups[0].infos[0].Path != "example.com/primary" || groups[0].infos[1].Path != "example.com/fallback" {
+		t.Fatalf("Unexpected mirrors: %v", groups[0].infos)
+	}
+	if _, found := groups[0].infos[0].Arguments[mirrorArg]; found {
+		t.Fatalf("Mirror argument passed to handler")
+	}
+	if infos[0].Arguments[mirrorArg] != "foo" {
+		t.Fatalf("Caller's arguments modified: %v", infos[0].Arguments)
+	}
+	if len(groups[1].infos) != 1 || groups[1].infos[0].Path != "example.com/other" {
+		t.Fatalf("Unexpected group: %v", groups[1].infos)
+	}
+}
+
+func TestMirrorFallback(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		Data: map[string][]string{
+			scmUriKey: {
+				"error://example.com/primary;mirror=foo",
+				"test://example.com/fallback;mirror=foo",
+			},
+		},
+	}
+	err := checkout(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestMirrorAllFail(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		Data: map[string][]string{
+			scmUriKey: {
+				"error://example.com/primary;mirror=foo",
+				"error://example.com/fallback;mirror=foo",
+			},
+		},
+	}
+	err := checkout(c)
+	if !errors.Is(err, errTestCheckout) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestMirrorTimeout(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		Data: map[string][]string{
+			scmUriKey: {
+				"slow://example.com/primary;mirror=foo",
+				"test://example.com/fallback;mirror=foo",
+			},
+			scmTimeoutKey: {"10ms"},
+		},
+	}
+	err := checkout(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func init() {
+	err := AddHandler("slow", makeSlowScm)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
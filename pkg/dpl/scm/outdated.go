@@ -0,0 +1,196 @@
+package scm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+	icmd "github.com/dev-pipeline/dpl-go/internal/cmd"
+	"github.com/dev-pipeline/dpl-go/internal/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type outdatedFlags struct {
+	JSON   bool
+	All    bool
+	Locked bool
+}
+
+type noUpstreamError struct {
+	scheme string
+}
+
+func (nue *noUpstreamError) Error() string {
+	return fmt.Sprintf("%v can't check upstream", nue.scheme)
+}
+
+type outdatedEntry struct {
+	Component string `json:"component"`
+	Scheme    string `json:"scheme"`
+	*UpstreamStatus
+	Error string `json:"error,omitempty"`
+
+	// set when the handler can't check upstream at all
+	unsupported bool
+}
+
+var (
+	scmOutdatedFlags outdatedFlags
+	outdatedCommon   common.Args
+
+	outdatedCmd = &cobra.Command{
+		Use:   "outdated [components]",
+		Short: "Show components whose upstream has newer revisions",
+		RunE:  doOutdated,
+	}
+)
+
+// componentUpstream checks each of a component's sources against upstream.
+// Like status, only the first source in each group is asked.
+func componentUpstream(component dpl.Component, locked bool) ([]outdatedEntry, error) {
+	scmUris, err := component.ExpandValues(scmUriKey)
+	if err != nil {
+		return nil, err
+	}
+	scmInfos, err := buildScmInfos(scmUris)
+	if err != nil {
+		return nil, err
+	}
+	groups := groupScmInfos(scmInfos)
+	if locked {
+		err = applyLock(component, scmUris, groups)
+		if err != nil {
+			return nil, err
+		}
+	}
+	entries := []outdatedEntry{}
+	for _, group := range groups {
+		info := group.infos[0]
+		entry := outdatedEntry{
+			Component: component.Name(),
+			Scheme:    info.Scheme,
+		}
+		status, err := sourceUpstream(component, info)
+		if err != nil {
+			entry.Error = err.Error()
+			_, entry.unsupported = err.(*noUpstreamError)
+		}
+		entry.UpstreamStatus = status
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func sourceUpstream(component dpl.Component, info ScmInfo) (*UpstreamStatus, error) {
+	scmBuilder := GetHandler(info.Scheme)
+	if scmBuilder == nil {
+		return nil, fmt.Errorf("no handler for scheme '%v'", info.Scheme)
+	}
+	handler, err := scmBuilder(component)
+	if err != nil {
+		return nil, err
+	}
+	upstreamHandler, ok := handler.(UpstreamScmHandler)
+	if !ok {
+		return nil, &noUpstreamError{
+			scheme: info.Scheme,
+		}
+	}
+	return upstreamHandler.Upstream(info)
+}
+
+// filterOutdated keeps the entries worth acting on: anything outdated, and
+// errors other than handlers that can't check at all.
+func filterOutdated(entries []outdatedEntry) []outdatedEntry {
+	filtered := []outdatedEntry{}
+	for _, entry := range entries {
+		if len(entry.Error) > 0 {
+			if !entry.unsupported {
+				filtered = append(filtered, entry)
+			}
+		} else if entry.UpstreamStatus != nil && entry.Outdated {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+func shortRevision(revision string) string {
+	if len(revision) == 0 {
+		return "-"
+	}
+	if len(revision) == 40 {
+		return revision[:12]
+	}
+	return revision
+}
+
+func describeBehind(status *UpstreamStatus) string {
+	if status.Behind == nil {
+		return "?"
+	}
+	return fmt.Sprint(*status.Behind)
+}
+
+func writeOutdatedTable(w io.Writer, entries []outdatedEntry) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "COMPONENT\tCURRENT\tLATEST\tBEHIND")
+	for _, entry := range entries {
+		status := entry.UpstreamStatus
+		if len(entry.Error) > 0 || status == nil {
+			fmt.Fprintf(table, "%v\terror: %v\t\t\n", entry.Component, entry.Error)
+			continue
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\n", entry.Component, shortRevision(status.Current),
+			shortRevision(status.Latest), describeBehind(status))
+	}
+	return table.Flush()
+}
+
+func writeOutdatedJSON(w io.Writer, entries []outdatedEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func doOutdated(cmd *cobra.Command, components []string) error {
+	project, components, err := common.LoadComponents(components, outdatedCommon)
+	if err != nil {
+		return err
+	}
+	entries := []outdatedEntry{}
+	for _, name := range components {
+		component, err := project.GetComponent(name)
+		if err != nil {
+			return err
+		}
+		componentEntries, err := componentUpstream(component, scmOutdatedFlags.Locked)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, componentEntries...)
+	}
+	if !scmOutdatedFlags.All {
+		entries = filterOutdated(entries)
+	}
+	if scmOutdatedFlags.JSON {
+		return writeOutdatedJSON(os.Stdout, entries)
+	}
+	return writeOutdatedTable(os.Stdout, entries)
+}
+
+func init() {
+	outdatedCmd.Flags().BoolVar(&scmOutdatedFlags.JSON, "json", false,
+		"Print the results as JSON")
+	outdatedCmd.Flags().BoolVar(&scmOutdatedFlags.All, "all", false,
+		"Include sources that are up to date")
+	outdatedCmd.Flags().BoolVar(&scmOutdatedFlags.Locked, "locked", false,
+		"Compare against the revisions in the lock file")
+	icmd.AddSelectionArgs(outdatedCmd, &outdatedCommon)
+	cmd.AddCommand(outdatedCmd)
+}
@@ -0,0 +1,104 @@
+package scm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type upstreamScm struct {
+	testScm
+}
+
+func (upstreamScm) Upstream(info ScmInfo) (*UpstreamStatus, error) {
+	switch info.Path {
+	case "example.com/current":
+		behind := 0
+		return &UpstreamStatus{
+			Current: "v1.2.0",
+			Latest:  "v1.2.0",
+			Behind:  &behind,
+		}, nil
+
+	case "example.com/broken":
+		return nil, fmt.Errorf("remote went away")
+	}
+	return &UpstreamStatus{
+		Current:  "0123456789abcdef0123456789abcdef01234567",
+		Latest:   "89abcdef0123456789abcdef0123456789abcdef",
+		Outdated: true,
+	}, nil
+}
+
+func makeUpstreamScm(dpl.Component) (ScmHandler, error) {
+	return &upstreamScm{}, nil
+}
+
+func TestComponentUpstream(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		ComponentName: "foo",
+		Data: map[string][]string{
+			scmUriKey: {
+				"upstream://example.com/moved",
+				"upstream://example.com/current",
+				"upstream://example.com/broken",
+				buildTestUri("some-uri"),
+			},
+		},
+	}
+	entries, err := componentUpstream(c, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+
+	// up to date sources and handlers that can't check are dropped
+	filtered := filterOutdated(entries)
+	if len(filtered) != 2 || filtered[0].Latest != "89abcdef0123456789abcdef0123456789abcdef" || !strings.Contains(filtered[1].Error, "went away") {
+		t.Fatalf("Unexpected entries: %v", filtered)
+	}
+
+	table := &bytes.Buffer{}
+	err = writeOutdatedTable(table, entries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Unexpected table:\n%v", table.String())
+	}
+	for i, expected := range []string{"89abcdef0123  ?", "v1.2.0        0", "remote went away", "test can't check upstream"} {
+		if !strings.Contains(lines[i+1], expected) {
+			t.Fatalf("Unexpected table:\n%v", table.String())
+		}
+	}
+
+	output := &bytes.Buffer{}
+	err = writeOutdatedJSON(output, entries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	decoded := []map[string]any{}
+	err = json.Unmarshal(output.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded[0]["outdated"] != true || decoded[0]["behind"] != nil || decoded[1]["behind"] != 0.0 {
+		t.Fatalf("Unexpected JSON: %v", output.String())
+	}
+}
+
+func init() {
+	err := AddHandler("upstream", makeUpstreamScm)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
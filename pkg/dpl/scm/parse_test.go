@@ -61,3 +61,26 @@ func TestBadParse(t *testing.T) {
 		t.Fatalf("Unexpected error type: %T", err)
 	}
 }
+
+func TestParseValueWithEquals(t *testing.T) {
+	scmInfo, err := BuildScmInfo("git://github.com/foo/bar.git;ref=semver:>=1.0 <2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	compareArgs(t, map[string]string{
+		"ref": "semver:>=1.0 <2",
+	}, scmInfo.Arguments)
+}
+
+func TestParseQuery(t *testing.T) {
+	scmInfo, err := BuildScmInfo("archive+https://example.com/foo.tar.gz?token=abc;sha256=1234")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if scmInfo.Path != "example.com/foo.tar.gz?token=abc" {
+		t.Fatalf("Unexpected uri (%v)", scmInfo.Path)
+	}
+	compareArgs(t, map[string]string{
+		"sha256": "1234",
+	}, scmInfo.Arguments)
+}
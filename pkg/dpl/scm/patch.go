@@ -0,0 +1,314 @@
+package scm
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	scmPatchesKey string = "scm.patches"
+
+	// copies of the applied patches live here, so they can be reverted even
+	// if the originals are edited or removed
+	patchStateDir string = ".dpl-patches"
+	// the revision the patches were applied on top of, kept with the copies
+	patchBaseFile string = "base"
+
+	// the git handler can put the repository above the source directory
+	gitRepoDirKey string = "scm.git.repo_dir"
+)
+
+type patchFailedError struct {
+	patch   string
+	reverse bool
+	output  string
+	// files holding hunks that didn't apply; the rest of the patch did
+	rejects []string
+}
+
+func (pfe *patchFailedError) Error() string {
+	action := "apply"
+	if pfe.reverse {
+		action = "revert"
+	}
+	message := fmt.Sprintf("couldn't %v patch %v:\n%v", action, pfe.patch, pfe.output)
+	if len(pfe.rejects) > 0 {
+		message = fmt.Sprintf("%v\nthe rest of the patch was applied; rejected hunks are in %v (use --force to start over)", message, strings.Join(pfe.rejects, ", "))
+	}
+	return message
+}
+
+// patchTarget is where git apply runs.  Patches are relative to the source
+// directory, which can be below the root of its repository.
+type patchTarget struct {
+	repoDir   string
+	directory string
+}
+
+func getPatchTarget(component dpl.Component) (patchTarget, error) {
+	srcDir := path.Clean(component.GetSourceDir())
+	repoDir, err := dpl.GetSingleComponentValueOrDefault(component, gitRepoDirKey, "")
+	if err != nil {
+		return patchTarget{}, err
+	}
+	if len(repoDir) == 0 {
+		return patchTarget{repoDir: srcDir}, nil
+	}
+	if !path.IsAbs(repoDir) {
+		repoDir = path.Join(srcDir, repoDir)
+	}
+	repoDir = path.Clean(repoDir)
+	directory, err := filepath.Rel(repoDir, srcDir)
+	if err != nil {
+		return patchTarget{}, err
+	}
+	directory = filepath.ToSlash(directory)
+	if !isInside(directory) {
+		return patchTarget{}, fmt.Errorf("%v isn't inside %v (%v)", srcDir, repoDir, gitRepoDirKey)
+	}
+	if directory == "." {
+		directory = ""
+	}
+	return patchTarget{
+		repoDir:   repoDir,
+		directory: directory,
+	}, nil
+}
+
+type appliedPatch struct {
+	name     string
+	filename string
+}
+
+// getPatchStateDir keeps the state inside .git when the source directory is
+// a repository, so it doesn't show up as an untracked file.
+func getPatchStateDir(srcDir string) string {
+	if info, err := os.Stat(path.Join(srcDir, ".git")); err == nil && info.IsDir() {
+		return path.Join(srcDir, ".git", "dpl-patches")
+	}
+	return path.Join(srcDir, patchStateDir)
+}
+
+func readAppliedPatches(stateDir string) ([]appliedPatch, error) {
+	entries, err := os.ReadDir(stateDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret := []appliedPatch{}
+	for _, entry := range entries {
+		// entries are named <index>-<patch>
+		_, name, found := strings.Cut(entry.Name(), "-")
+		if !found || entry.IsDir() {
+			continue
+		}
+		ret = append(ret, appliedPatch{
+			name:     name,
+			filename: path.Join(stateDir, entry.Name()),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].filename < ret[j].filename
+	})
+	return ret, nil
+}
+
+func runGitApply(target patchTarget, filename string, args ...string) (string, error) {
+	args = append([]string{"apply", "--verbose"}, args...)
+	if len(target.directory) > 0 {
+		args = append(args, fmt.Sprintf("--directory=%v", target.directory))
+	}
+	cmd := exec.Command("git", append(args, filename)...)
+	cmd.Dir = target.repoDir
+	// don't let git discover a repository above this one, or it would
+	// resolve the patch's paths against that one instead
+	cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_CEILING_DIRECTORIES=%v", path.Dir(target.repoDir)))
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// rejectFiles lists the .rej files git apply --reject reported writing.
+func rejectFiles(target patchTarget, output string) []string {
+	rejects := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		name, found := strings.CutPrefix(line, "Applying patch ")
+		if !found {
+			continue
+		}
+		name, found = strings.CutSuffix(name, "...")
+		if !found {
+			continue
+		}
+		if name, _, found = strings.Cut(name, " with "); found {
+			rejects = append(rejects, path.Join(target.repoDir, name+".rej"))
+		}
+	}
+	return rejects
+}
+
+// applyPatch checks the whole patch before touching anything, so a patch
+// that can't be reverted leaves the tree as it was.  A patch that doesn't
+// apply is applied as far as it can be, leaving the rejected hunks for
+// someone to look at.
+func applyPatch(target patchTarget, name string, filename string, reverse bool) error {
+	args := []string{}
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	output, err := runGitApply(target, filename, append(args, "--check")...)
+	if err == nil {
+		output, err = runGitApply(target, filename, args...)
+	} else if !reverse {
+		output, err = runGitApply(target, filename, "--reject")
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		}
+		pfe := &patchFailedError{
+			patch:   name,
+			reverse: reverse,
+			output:  output,
+		}
+		if !reverse {
+			pfe.rejects = rejectFiles(target, output)
+		}
+		return pfe
+	}
+	return nil
+}
+
+// revertPatches undoes whatever a previous checkout applied, newest first, so
+// the scm handler sees the tree it left behind.
+func revertPatches(target patchTarget) error {
+	stateDir := getPatchStateDir(target.repoDir)
+	applied, err := readAppliedPatches(stateDir)
+	if err != nil {
+		return err
+	}
+	for i := len(applied) - 1; i >= 0; i-- {
+		err = applyPatch(target, applied[i].name, applied[i].filename, true)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(applied[i].filename)
+		if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(stateDir)
+}
+
+// patchesCurrent reports whether the patches already applied are the ones
+// configured, on top of a revision the checkout can't move.  Reverting and
+// reapplying them would only churn the files they touch.
+func patchesCurrent(component dpl.Component, groups []*scmGroup, options CheckoutOptions) (bool, error) {
+	if len(groups) != 1 || options.Force || options.Stash {
+		return false, nil
+	}
+	target, err := getPatchTarget(component)
+	if err != nil {
+		return false, err
+	}
+	stateDir := getPatchStateDir(target.repoDir)
+	applied, err := readAppliedPatches(stateDir)
+	if err != nil || len(applied) == 0 {
+		return false, err
+	}
+	patches, err := component.ExpandValues(scmPatchesKey)
+	if err != nil || len(patches) != len(applied) {
+		return false, err
+	}
+	for i, patch := range patches {
+		filename, err := configRelativePath(component, patch)
+		if err != nil {
+			return false, err
+		}
+		wanted, err := os.ReadFile(filename)
+		if err != nil {
+			return false, err
+		}
+		current, err := os.ReadFile(applied[i].filename)
+		if err != nil {
+			return false, err
+		}
+		if applied[i].name != path.Base(patch) || !bytes.Equal(wanted, current) {
+			return false, nil
+		}
+	}
+	base := readMarker(stateDir, patchBaseFile)
+	info := groups[0].infos[0]
+	pinned := options.Update == UpdateNever || info.Options.Revision == base
+	if len(base) == 0 || !pinned {
+		return false, nil
+	}
+	status, err := sourceStatus(component, info)
+	if err != nil {
+		// a handler that can't say what's checked out can't be trusted
+		// to leave it alone
+		return false, nil
+	}
+	return !status.Missing && status.Commit == base, nil
+}
+
+func applyPatches(component dpl.Component, groups []*scmGroup) error {
+	patches, err := component.ExpandValues(scmPatchesKey)
+	if err != nil || len(patches) == 0 {
+		return err
+	}
+	srcDir := component.GetSourceDir()
+	if target, err := os.Readlink(srcDir); err == nil {
+		// patching through the link would edit the original
+		return fmt.Errorf("won't patch %v, since it's a symlink to %v (use mode=copy)", srcDir, target)
+	}
+	target, err := getPatchTarget(component)
+	if err != nil {
+		return err
+	}
+	stateDir := getPatchStateDir(target.repoDir)
+	err = os.MkdirAll(stateDir, 0755)
+	if err != nil {
+		return err
+	}
+	for i, patch := range patches {
+		filename, err := configRelativePath(component, patch)
+		if err != nil {
+			return err
+		}
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		err = applyPatch(target, patch, filename, false)
+		if err != nil {
+			return err
+		}
+		stateName := fmt.Sprintf("%04d-%v", i, path.Base(patch))
+		err = os.WriteFile(path.Join(stateDir, stateName), contents, 0644)
+		if err != nil {
+			return err
+		}
+		log.Printf("%v: applied %v", component.Name(), patch)
+	}
+	if len(groups) != 1 {
+		return nil
+	}
+	status, err := sourceStatus(component, groups[0].infos[0])
+	if err != nil || status.Missing {
+		// nothing to compare against next time, so the patches will
+		// always be reapplied
+		return nil
+	}
+	return os.WriteFile(path.Join(stateDir, patchBaseFile), []byte(status.Commit+"\n"), 0644)
+}
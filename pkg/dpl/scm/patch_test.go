@@ -0,0 +1,227 @@
+package scm
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+const (
+	fooPatch string = `--- a/foo.c
++++ b/foo.c
+@@ -1,3 +1,3 @@
+ int foo() {
+-    return 0;
++    return 1;
+ }
+`
+	barPatch string = `--- a/foo.c
++++ b/foo.c
+@@ -1,3 +1,4 @@
+ int foo() {
++    bar();
+     return 1;
+ }
+`
+	fooSource string = "int foo() {\n    return 0;\n}\n"
+)
+
+type patchFile struct {
+	name     string
+	contents string
+}
+
+type patchTest struct {
+	t         *testing.T
+	rootDir   string
+	srcDir    string
+	component *testcommon.ResolveComponent
+}
+
+func makePatchTest(t *testing.T, patches ...patchFile) *patchTest {
+	rootDir := t.TempDir()
+	srcDir := path.Join(t.TempDir(), "src")
+	pt := &patchTest{
+		t:       t,
+		rootDir: rootDir,
+		srcDir:  srcDir,
+		component: &testcommon.ResolveComponent{
+			SourceDir: srcDir,
+			Data: map[string][]string{
+				scmUriKey:    {buildTestUri("some-uri")},
+				configDirKey: {rootDir},
+			},
+		},
+	}
+	for _, patch := range patches {
+		pt.write(path.Join(rootDir, patch.name), patch.contents)
+		pt.component.Data[scmPatchesKey] = append(pt.component.Data[scmPatchesKey], patch.name)
+	}
+	pt.write(path.Join(srcDir, "foo.c"), fooSource)
+	return pt
+}
+
+func (pt *patchTest) write(filename string, contents string) {
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		pt.t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		pt.t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func (pt *patchTest) expectSource(expected string) {
+	contents, err := os.ReadFile(path.Join(pt.srcDir, "foo.c"))
+	if err != nil {
+		pt.t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(contents) != expected {
+		pt.t.Fatalf("Unexpected contents: %v", string(contents))
+	}
+}
+
+func TestPatchesApplied(t *testing.T) {
+	pt := makePatchTest(t,
+		patchFile{name: "patches/foo.patch", contents: fooPatch},
+		patchFile{name: "patches/bar.patch", contents: barPatch},
+	)
+
+	// running twice shouldn't apply anything twice
+	for i := 0; i < 2; i++ {
+		err := checkout(pt.component)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		pt.expectSource("int foo() {\n    bar();\n    return 1;\n}\n")
+	}
+}
+
+func TestPatchesRemoved(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "foo.patch", contents: fooPatch})
+	err := checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	delete(pt.component.Data, scmPatchesKey)
+	err = checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pt.expectSource(fooSource)
+	if _, err := os.Stat(path.Join(pt.srcDir, patchStateDir)); !os.IsNotExist(err) {
+		t.Fatalf("Patch state left behind (%v)", err)
+	}
+}
+
+func TestPatchFails(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "bar.patch", contents: barPatch})
+	err := checkout(pt.component)
+	pfe, ok := err.(*patchFailedError)
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pfe.patch != "bar.patch" || !strings.Contains(pfe.output, "patch failed: foo.c:1") {
+		t.Fatalf("Unexpected report: %v", pfe)
+	}
+	rejects := path.Join(pt.srcDir, "foo.c.rej")
+	if len(pfe.rejects) != 1 || pfe.rejects[0] != rejects {
+		t.Fatalf("Unexpected rejects: %v", pfe.rejects)
+	}
+	if _, err := os.Stat(rejects); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pt.expectSource(fooSource)
+}
+
+func TestPatchesSkippedWhenCurrent(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "foo.patch", contents: fooPatch})
+	pt.component.Data[scmUriKey] = []string{"status://example.com/primary"}
+	pt.component.Data[scmUpdateKey] = []string{UpdateNever}
+	err := checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// reapplying would rewrite the file
+	filename := path.Join(pt.srcDir, "foo.c")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(filename, past, past)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pt.expectSource("int foo() {\n    return 1;\n}\n")
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Fatalf("Patches were reapplied")
+	}
+}
+
+func TestPatchSymlinkRefused(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "foo.patch", contents: fooPatch})
+	original := path.Join(t.TempDir(), "original")
+	err := os.Rename(pt.srcDir, original)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.Symlink(original, pt.srcDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = checkout(pt.component)
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	pt.expectSource(fooSource)
+}
+
+func TestPatchRepoDir(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "foo.patch", contents: fooPatch})
+	pt.component.Data[gitRepoDirKey] = []string{".."}
+	repoDir := path.Dir(pt.srcDir)
+	cmd := exec.Command("git", "init", "--quiet", repoDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (%v)", err, string(output))
+	}
+	err = checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pt.expectSource("int foo() {\n    return 1;\n}\n")
+	if _, err := os.Stat(path.Join(repoDir, ".git", "dpl-patches")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPatchStateInGitDir(t *testing.T) {
+	pt := makePatchTest(t, patchFile{name: "foo.patch", contents: fooPatch})
+	cmd := exec.Command("git", "init", "--quiet", pt.srcDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (%v)", err, string(output))
+	}
+	err = checkout(pt.component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pt.expectSource("int foo() {\n    return 1;\n}\n")
+	if _, err := os.Stat(path.Join(pt.srcDir, patchStateDir)); !os.IsNotExist(err) {
+		t.Fatalf("Patch state written to the work tree (%v)", err)
+	}
+	if _, err := os.Stat(path.Join(pt.srcDir, ".git", "dpl-patches")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package scm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+	icmd "github.com/dev-pipeline/dpl-go/internal/cmd"
+	"github.com/dev-pipeline/dpl-go/internal/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type statusFlags struct {
+	JSON bool
+}
+
+type noStatusError struct {
+	scheme string
+}
+
+func (nse *noStatusError) Error() string {
+	return fmt.Sprintf("%v doesn't report status", nse.scheme)
+}
+
+type statusEntry struct {
+	Component string `json:"component"`
+	Scheme    string `json:"scheme"`
+	*SourceStatus
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	scmStatusFlags statusFlags
+	statusCommon   common.Args
+
+	statusCmd = &cobra.Command{
+		Use:   "status [components]",
+		Short: "Show the state of each component's source tree",
+		RunE:  doStatus,
+	}
+)
+
+// componentStatus describes each of a component's sources.  Mirrors are
+// alternate locations for the same source, so only the first is asked.
+func componentStatus(component dpl.Component) ([]statusEntry, error) {
+	scmUris, err := component.ExpandValues(scmUriKey)
+	if err != nil {
+		return nil, err
+	}
+	scmInfos, err := buildScmInfos(scmUris)
+	if err != nil {
+		return nil, err
+	}
+	entries := []statusEntry{}
+	for _, group := range groupScmInfos(scmInfos) {
+		info := group.infos[0]
+		entry := statusEntry{
+			Component: component.Name(),
+			Scheme:    info.Scheme,
+		}
+		status, err := sourceStatus(component, info)
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		entry.SourceStatus = status
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func sourceStatus(component dpl.Component, info ScmInfo) (*SourceStatus, error) {
+	scmBuilder := GetHandler(info.Scheme)
+	if scmBuilder == nil {
+		return nil, fmt.Errorf("no handler for scheme '%v'", info.Scheme)
+	}
+	handler, err := scmBuilder(component)
+	if err != nil {
+		return nil, err
+	}
+	statusHandler, ok := handler.(StatusScmHandler)
+	if !ok {
+		return nil, &noStatusError{
+			scheme: info.Scheme,
+		}
+	}
+	return statusHandler.Status(info)
+}
+
+func describeUpstream(status *SourceStatus) string {
+	if len(status.Upstream) == 0 {
+		return "-"
+	}
+	if status.Ahead == 0 && status.Behind == 0 {
+		return fmt.Sprintf("%v (up to date)", status.Upstream)
+	}
+	return fmt.Sprintf("%v (+%v -%v)", status.Upstream, status.Ahead, status.Behind)
+}
+
+func describeRef(status *SourceStatus) string {
+	if len(status.Ref) == 0 {
+		return "-"
+	}
+	if status.MatchesRef {
+		return status.Ref
+	}
+	return fmt.Sprintf("%v (differs)", status.Ref)
+}
+
+func describeChanges(status *SourceStatus) string {
+	changes := []string{}
+	if len(status.Modified) > 0 {
+		changes = append(changes, fmt.Sprintf("%v modified", len(status.Modified)))
+	}
+	if len(status.Untracked) > 0 {
+		changes = append(changes, fmt.Sprintf("%v untracked", len(status.Untracked)))
+	}
+	if len(changes) == 0 {
+		return "clean"
+	}
+	return strings.Join(changes, ", ")
+}
+
+func writeStatusTable(w io.Writer, entries []statusEntry) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "COMPONENT\tBRANCH\tCOMMIT\tREF\tUPSTREAM\tCHANGES")
+	for _, entry := range entries {
+		status := entry.SourceStatus
+		switch {
+		case len(entry.Error) > 0:
+			fmt.Fprintf(table, "%v\terror: %v\t\t\t\t\n", entry.Component, entry.Error)
+
+		case status == nil || status.Missing:
+			fmt.Fprintf(table, "%v\tnot checked out\t\t\t\t\n", entry.Component)
+
+		default:
+			branch := status.Branch
+			if len(branch) == 0 {
+				branch = "(detached)"
+			}
+			commit := status.Commit
+			if len(commit) > 12 {
+				commit = commit[:12]
+			}
+			fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\t%v\n", entry.Component, branch, commit,
+				describeRef(status), describeUpstream(status), describeChanges(status))
+		}
+	}
+	return table.Flush()
+}
+
+func writeStatusJSON(w io.Writer, entries []statusEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func doStatus(cmd *cobra.Command, components []string) error {
+	project, components, err := common.LoadComponents(components, statusCommon)
+	if err != nil {
+		return err
+	}
+	entries := []statusEntry{}
+	for _, name := range components {
+		component, err := project.GetComponent(name)
+		if err != nil {
+			return err
+		}
+		componentEntries, err := componentStatus(component)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, componentEntries...)
+	}
+	if scmStatusFlags.JSON {
+		return writeStatusJSON(os.Stdout, entries)
+	}
+	return writeStatusTable(os.Stdout, entries)
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&scmStatusFlags.JSON, "json", false,
+		"Print the status as JSON")
+	icmd.AddSelectionArgs(statusCmd, &statusCommon)
+	cmd.AddCommand(statusCmd)
+}
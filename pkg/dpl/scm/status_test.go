@@ -0,0 +1,93 @@
+package scm
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+type statusScm struct {
+	testScm
+}
+
+func (statusScm) Status(info ScmInfo) (*SourceStatus, error) {
+	if info.Path == "example.com/missing" {
+		return &SourceStatus{
+			Missing: true,
+		}, nil
+	}
+	return &SourceStatus{
+		Branch:     "main",
+		Commit:     "0123456789abcdef0123456789abcdef01234567",
+		Ref:        "main",
+		MatchesRef: true,
+		Upstream:   "origin/main",
+		Behind:     2,
+		Modified:   []string{"foo.c"},
+	}, nil
+}
+
+func makeStatusScm(dpl.Component) (ScmHandler, error) {
+	return &statusScm{}, nil
+}
+
+func TestComponentStatus(t *testing.T) {
+	c := &testcommon.ResolveComponent{
+		Data: map[string][]string{
+			scmUriKey: {
+				"status://example.com/primary;mirror=foo",
+				"status://example.com/secondary;mirror=foo",
+				"status://example.com/missing",
+				buildTestUri("some-uri"),
+			},
+		},
+	}
+	entries, err := componentStatus(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+
+	table := &bytes.Buffer{}
+	err = writeStatusTable(table, entries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Unexpected table:\n%v", table.String())
+	}
+	for i, expected := range []string{"origin/main (+0 -2)", "not checked out", "test doesn't report status"} {
+		if !strings.Contains(lines[i+1], expected) {
+			t.Fatalf("Unexpected table:\n%v", table.String())
+		}
+	}
+
+	output := &bytes.Buffer{}
+	err = writeStatusJSON(output, entries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	decoded := []map[string]any{}
+	err = json.Unmarshal(output.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded[0]["behind"] != 2.0 || decoded[1]["missing"] != true || len(decoded[2]["error"].(string)) == 0 {
+		t.Fatalf("Unexpected JSON: %v", output.String())
+	}
+}
+
+func init() {
+	err := AddHandler("status", makeStatusScm)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
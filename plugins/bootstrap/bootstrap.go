@@ -29,5 +29,6 @@ func doBootstrap(cmd *cobra.Command, args []string) error {
 
 func init() {
 	icmd.AddCommonArgs(bootstrapCmd, &bootstrapCommon)
+	scm.AddCheckoutFlags(bootstrapCmd)
 	cmd.AddCommand(bootstrapCmd)
 }
@@ -54,6 +54,10 @@ func (cb cmakeBuilder) Configure(config *build.BuildConfig) error {
 			args = append(args, flags...)
 		}
 	}
+	if config.Offline {
+		// keeps FetchContent from reaching out for dependencies
+		args = append(args, "-DFETCHCONTENT_FULLY_DISCONNECTED=ON")
+	}
 	return cb.runCmake(cmakeFlags{
 		args: append(args, cb.component.GetSourceDir()),
 		env:  config.Env,
@@ -0,0 +1,323 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+// Only the names of environment variables and paths to files are ever read
+// from the configuration; secrets themselves stay out of the build cache.
+const (
+	sshKeyKey              string = "scm.git.ssh_key"
+	sshKeyPassphraseEnvKey string = "scm.git.ssh_key_passphrase_env"
+	sshAgentKey            string = "scm.git.ssh_agent"
+	knownHostsKey          string = "scm.git.known_hosts"
+	tokenEnvKey            string = "scm.git.token_env"
+	tokenUserKey           string = "scm.git.token_user"
+	netrcKey               string = "scm.git.netrc"
+
+	defaultTokenUser string = "x-access-token"
+	defaultSshUser   string = "git"
+)
+
+var (
+	errMissingToken error = fmt.Errorf("token environment variable is empty")
+)
+
+// remoteURL builds the URL git should talk to.  The scheme of scm.uri selects
+// the git handler, so a transport goes after a plus (e.g., git+https), the
+// same way archive URIs name theirs.  Without one, the path is used as is.
+func remoteURL(info scm.ScmInfo) string {
+	if _, transport, found := strings.Cut(info.Scheme, "+"); found {
+		return fmt.Sprintf("%v://%v", transport, info.Path)
+	}
+	return info.Path
+}
+
+func expandHome(filename string) (string, error) {
+	if !strings.HasPrefix(filename, "~/") {
+		return filename, nil
+	}
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(homedir, filename[2:]), nil
+}
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+type netrcSyntaxError struct {
+	filename string
+	token    string
+}
+
+func (nse *netrcSyntaxError) Error() string {
+	return fmt.Sprintf("unsupported token in %v (%v); quoted values aren't supported", nse.filename, nse.token)
+}
+
+// parseNetrc reads the subset of the netrc format git cares about.  Entries
+// are keyed by machine name, with "default" used as a fallback.  Tokens are
+// split on whitespace: machine, default, login and password are used,
+// account is skipped, and parsing stops at the first macdef (its body can't
+// be told apart from tokens).  Quoted values aren't supported and are
+// reported as errors rather than guessed at.
+func parseNetrc(filename string) (map[string]netrcEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := map[string]netrcEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Split(bufio.ScanWords)
+	machine := ""
+	entry := netrcEntry{}
+	flush := func() {
+		if len(machine) > 0 {
+			entries[machine] = entry
+		}
+		machine = ""
+		entry = netrcEntry{}
+	}
+	// value reads the token after a keyword
+	value := func() (string, error) {
+		if !scanner.Scan() {
+			return "", scanner.Err()
+		}
+		token := scanner.Text()
+		if strings.HasPrefix(token, "\"") {
+			return "", &netrcSyntaxError{
+				filename: filename,
+				token:    token,
+			}
+		}
+		return token, nil
+	}
+	for scanner.Scan() {
+		var err error
+		switch scanner.Text() {
+		case "machine":
+			flush()
+			machine, err = value()
+
+		case "default":
+			flush()
+			machine = "default"
+
+		case "login":
+			entry.login, err = value()
+
+		case "password":
+			entry.password, err = value()
+
+		case "account":
+			_, err = value()
+
+		case "macdef":
+			// macros run until a blank line, which the word scanner can't see;
+			// nothing after one is reliable, so stop here
+			flush()
+			return entries, scanner.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	flush()
+	return entries, scanner.Err()
+}
+
+func getNetrcPath(component dpl.Component) (string, error) {
+	fallback := os.Getenv("NETRC")
+	if len(fallback) == 0 {
+		homedir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		fallback = path.Join(homedir, ".netrc")
+	}
+	netrcPath, err := dpl.GetSingleComponentValueOrDefault(component, netrcKey, fallback)
+	if err != nil {
+		return "", err
+	}
+	return expandHome(netrcPath)
+}
+
+func getNetrcAuth(component dpl.Component, host string) (transport.AuthMethod, error) {
+	netrcPath, err := getNetrcPath(component)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseNetrc(netrcPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entry, found := entries[host]
+	if !found {
+		entry, found = entries["default"]
+		if !found {
+			return nil, nil
+		}
+	}
+	return &http.BasicAuth{
+		Username: entry.login,
+		Password: entry.password,
+	}, nil
+}
+
+func getHttpAuth(component dpl.Component, endpoint *transport.Endpoint) (transport.AuthMethod, error) {
+	if len(endpoint.User) > 0 && len(endpoint.Password) > 0 {
+		// credentials in the URL win; go-git will use them directly
+		return nil, nil
+	}
+	tokenEnv, err := dpl.GetSingleComponentValueOrDefault(component, tokenEnvKey, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(tokenEnv) > 0 {
+		token := os.Getenv(tokenEnv)
+		if len(token) == 0 {
+			return nil, fmt.Errorf("%w (%v)", errMissingToken, tokenEnv)
+		}
+		user, err := dpl.GetSingleComponentValueOrDefault(component, tokenUserKey, defaultTokenUser)
+		if err != nil {
+			return nil, err
+		}
+		return &http.BasicAuth{
+			Username: user,
+			Password: token,
+		}, nil
+	}
+	return getNetrcAuth(component, endpoint.Host)
+}
+
+func getKnownHosts(component dpl.Component) ([]string, error) {
+	knownHosts, err := component.ExpandValues(knownHostsKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range knownHosts {
+		knownHosts[i], err = expandHome(knownHosts[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return knownHosts, nil
+}
+
+func setKnownHosts(knownHosts []string, helper *ssh.HostKeyCallbackHelper) error {
+	if len(knownHosts) == 0 {
+		// go-git falls back to SSH_KNOWN_HOSTS or the usual ssh locations
+		return nil
+	}
+	callback, err := ssh.NewKnownHostsCallback(knownHosts...)
+	if err != nil {
+		return err
+	}
+	helper.HostKeyCallback = callback
+	return nil
+}
+
+// sshAuth is what go-git needs, plus where it came from so the exec backend
+// can hand the same settings to ssh.
+type sshAuth struct {
+	ssh.AuthMethod
+	keyFile       string
+	passphraseEnv string
+	knownHosts    []string
+}
+
+func getSshAuth(component dpl.Component, endpoint *transport.Endpoint) (transport.AuthMethod, error) {
+	user := endpoint.User
+	if len(user) == 0 {
+		user = defaultSshUser
+	}
+	knownHosts, err := getKnownHosts(component)
+	if err != nil {
+		return nil, err
+	}
+	keyFile, err := dpl.GetSingleComponentValueOrDefault(component, sshKeyKey, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(keyFile) > 0 {
+		keyFile, err = expandHome(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		passphraseEnv, err := dpl.GetSingleComponentValueOrDefault(component, sshKeyPassphraseEnvKey, "")
+		if err != nil {
+			return nil, err
+		}
+		passphrase := ""
+		if len(passphraseEnv) > 0 {
+			passphrase = os.Getenv(passphraseEnv)
+		}
+		auth, err := ssh.NewPublicKeysFromFile(user, keyFile, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return &sshAuth{
+			AuthMethod:    auth,
+			keyFile:       keyFile,
+			passphraseEnv: passphraseEnv,
+			knownHosts:    knownHosts,
+		}, setKnownHosts(knownHosts, &auth.HostKeyCallbackHelper)
+	}
+
+	rawUseAgent, err := dpl.GetSingleComponentValueOrDefault(component, sshAgentKey, "true")
+	if err != nil {
+		return nil, err
+	}
+	useAgent, err := strconv.ParseBool(rawUseAgent)
+	if err != nil {
+		return nil, err
+	}
+	if !useAgent || len(os.Getenv("SSH_AUTH_SOCK")) == 0 {
+		return nil, nil
+	}
+	auth, err := ssh.NewSSHAgentAuth(user)
+	if err != nil {
+		return nil, err
+	}
+	return &sshAuth{
+		AuthMethod: auth,
+		knownHosts: knownHosts,
+	}, setKnownHosts(knownHosts, &auth.HostKeyCallbackHelper)
+}
+
+// getAuth picks credentials for url based on the component's configuration.
+// A nil method (with no error) means go-git should use its defaults.
+func getAuth(component dpl.Component, url string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	switch endpoint.Protocol {
+	case "http", "https":
+		return getHttpAuth(component, endpoint)
+
+	case "ssh":
+		return getSshAuth(component, endpoint)
+	}
+	return nil, nil
+}
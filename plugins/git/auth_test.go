@@ -0,0 +1,265 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+const (
+	testUser  string = "dpl-user"
+	testToken string = "dpl-secret"
+)
+
+// serveUpstream exposes an upstream repository through git's smart HTTP
+// backend, requiring basic auth with the test credentials.
+func serveUpstream(t *testing.T, upstream *upstreamRepo) string {
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	backend := &cgi.Handler{
+		Path: path.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Env: []string{
+			fmt.Sprintf("GIT_PROJECT_ROOT=%v", path.Dir(upstream.dir)),
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != testUser || password != testToken {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dpl"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return fmt.Sprintf("%v/%v", strings.TrimPrefix(server.URL, "http://"), path.Base(upstream.dir))
+}
+
+func runAuthCheckout(t *testing.T, data map[string][]string, info map[string]string, remote string) error {
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		Data:      data,
+		SourceDir: path.Join(t.TempDir(), "src"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scmInfo := buildInfo(remote, info)
+	scmInfo.Scheme = "git+http"
+	return handler.Checkout(scmInfo)
+}
+
+func TestHttpTokenAuth(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	remote := serveUpstream(t, upstream)
+
+	t.Setenv("DPL_TEST_TOKEN", testToken)
+	err := runAuthCheckout(t, map[string][]string{
+		tokenEnvKey:  {"DPL_TEST_TOKEN"},
+		tokenUserKey: {testUser},
+	}, map[string]string{}, remote)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestHttpMissingToken(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	remote := serveUpstream(t, upstream)
+
+	t.Setenv("DPL_TEST_TOKEN", "")
+	err := runAuthCheckout(t, map[string][]string{
+		tokenEnvKey: {"DPL_TEST_TOKEN"},
+	}, map[string]string{}, remote)
+	if err == nil {
+		t.Fatalf("Missing expected error")
+	}
+}
+
+func TestHttpNoAuth(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	remote := serveUpstream(t, upstream)
+
+	t.Setenv("NETRC", path.Join(t.TempDir(), "missing"))
+	err := runAuthCheckout(t, nil, map[string]string{}, remote)
+	if err == nil {
+		t.Fatalf("Missing expected error")
+	}
+}
+
+func TestHttpNetrcAuth(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	remote := serveUpstream(t, upstream)
+
+	netrc := path.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(netrc, []byte(fmt.Sprintf("machine example.com login nobody password nothing\nmachine 127.0.0.1\n  login %v\n  password %v\n", testUser, testToken)), 0600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = runAuthCheckout(t, map[string][]string{
+		netrcKey: {netrc},
+	}, map[string]string{}, remote)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseNetrcDefault(t *testing.T) {
+	netrc := path.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(netrc, []byte("machine a.example.com login a password b\ndefault login c password d\n"), 0600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	entries, err := parseNetrc(netrc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]netrcEntry{
+		"a.example.com": {login: "a", password: "b"},
+		"default":       {login: "c", password: "d"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+	for machine, entry := range expected {
+		if entries[machine] != entry {
+			t.Fatalf("Unexpected entry for %v: %v", machine, entries[machine])
+		}
+	}
+}
+
+func TestParseNetrcSubset(t *testing.T) {
+	netrc := path.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(netrc, []byte("machine a.example.com account login login a password b\nmacdef init\nmachine ignored login x password y\n"), 0600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	entries, err := parseNetrc(netrc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries["a.example.com"] != (netrcEntry{login: "a", password: "b"}) {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+}
+
+func TestParseNetrcQuoted(t *testing.T) {
+	netrc := path.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(netrc, []byte("machine a.example.com login a password \"b c\"\n"), 0600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = parseNetrc(netrc)
+	if _, ok := err.(*netrcSyntaxError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSshKeyAuth(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keyFile := path.Join(t.TempDir(), "id_ed25519")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	auth, err := getAuth(&testcommon.ResolveComponent{
+		Data: map[string][]string{
+			sshKeyKey: {keyFile},
+		},
+	}, "ssh://deploy@example.com/foo.git")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wrapped, ok := auth.(*sshAuth)
+	if !ok {
+		t.Fatalf("Unexpected auth method: %T", auth)
+	}
+	if wrapped.keyFile != keyFile {
+		t.Fatalf("Unexpected key file: %v", wrapped.keyFile)
+	}
+	keys, ok := wrapped.AuthMethod.(*gitssh.PublicKeys)
+	if !ok {
+		t.Fatalf("Unexpected auth method: %T", wrapped.AuthMethod)
+	}
+	if keys.User != "deploy" {
+		t.Fatalf("Unexpected user: %v", keys.User)
+	}
+}
+
+func TestSshNoAgent(t *testing.T) {
+	auth, err := getAuth(&testcommon.ResolveComponent{
+		Data: map[string][]string{
+			sshAgentKey: {"false"},
+		},
+	}, "ssh://git@example.com/foo.git")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if auth != nil {
+		t.Fatalf("Unexpected auth method: %T", auth)
+	}
+}
+
+func TestSshExecEnv(t *testing.T) {
+	t.Setenv("GIT_SSH_COMMAND", "")
+	env, cleanup, err := authEnv(&sshAuth{
+		keyFile:       "/keys/it's",
+		passphraseEnv: "DPL_TEST_PASSPHRASE",
+		knownHosts:    []string{"/hosts/known hosts"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	values := map[string]string{}
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		values[key] = value
+	}
+	expected := `ssh -o IdentitiesOnly=yes -i '/keys/it'\''s' -o 'UserKnownHostsFile "/hosts/known hosts"' -o StrictHostKeyChecking=yes`
+	if values["GIT_SSH_COMMAND"] != expected {
+		t.Fatalf("Unexpected ssh command: %v", values["GIT_SSH_COMMAND"])
+	}
+
+	askpass := values["SSH_ASKPASS"]
+	cmd := exec.Command(askpass)
+	cmd.Env = append(os.Environ(), "DPL_TEST_PASSPHRASE=secret")
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(output) != "secret\n" {
+		t.Fatalf("Unexpected passphrase: %v", string(output))
+	}
+	cleanup()
+	if _, err := os.Stat(askpass); !os.IsNotExist(err) {
+		t.Fatalf("Askpass script left behind: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	backendKey string = "scm.git.backend"
+
+	backendGoGit string = "gogit"
+	backendExec  string = "exec"
+)
+
+// backend does the work that touches a remote or rewrites the worktree.
+// Everything else (resolving refs, safety checks, branch updates) is done
+// with go-git regardless, so both backends share the same semantics.
+type backend interface {
+	// clone creates a repository in srcDir without checking anything out.
+	// If branch is set, it's the only branch cloned.
+	clone(srcDir string, settings cloneSettings, branch plumbing.ReferenceName) (*gogit.Repository, error)
+
+	// fetch updates an existing repository.  If specs is empty, the
+	// remote's configured refspecs are used.
+	fetch(r *gogit.Repository, settings cloneSettings, specs []config.RefSpec, depth int) error
+
+	listRemote(settings cloneSettings) ([]*plumbing.Reference, error)
+
+	// checkout moves the worktree to options, limiting it to sparse if
+	// there are any sparse directories.
+	checkout(ctx context.Context, r *gogit.Repository, options *gogit.CheckoutOptions, sparse []string) error
+
+	updateSubmodules(r *gogit.Repository, settings cloneSettings) error
+
+	createMirror(ctx context.Context, mirrorDir string, url string, auth transport.AuthMethod) error
+	fetchMirror(ctx context.Context, mirrorDir string, url string, auth transport.AuthMethod) error
+}
+
+var (
+	// tests swap this to run the same suite against each backend
+	defaultBackend string = backendGoGit
+
+	backends = map[string]backend{
+		backendGoGit: gogitBackend{},
+		backendExec:  execBackend{},
+	}
+)
+
+func getBackend(component dpl.Component) (backend, error) {
+	name, err := dpl.GetSingleComponentValueOrDefault(component, backendKey, defaultBackend)
+	if err != nil {
+		return nil, err
+	}
+	b, found := backends[name]
+	if !found {
+		return nil, &invalidArgumentError{
+			arg:   backendKey,
+			value: name,
+		}
+	}
+	return b, nil
+}
+
+type gogitBackend struct{}
+
+func (gogitBackend) clone(srcDir string, settings cloneSettings, branch plumbing.ReferenceName) (*gogit.Repository, error) {
+	url, auth := settings.source()
+	srcDir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gogit.CloneContext(settings.ctx, repositoryStorage(srcDir), osfs.New(srcDir), &gogit.CloneOptions{
+		URL:           url,
+		Auth:          auth,
+		NoCheckout:    true,
+		Depth:         settings.depth,
+		SingleBranch:  settings.singleBranch,
+		ReferenceName: branch,
+		Tags:          settings.tags,
+		Shared:        settings.shared(),
+	})
+	if err != nil {
+		// don't leave a half-cloned repository for the next run to find
+		os.RemoveAll(path.Join(srcDir, gogit.GitDirName))
+		return nil, err
+	}
+	return r, nil
+}
+
+func (gogitBackend) fetch(r *gogit.Repository, settings cloneSettings, specs []config.RefSpec, depth int) error {
+	url, auth := settings.source()
+	err := r.FetchContext(settings.ctx, &gogit.FetchOptions{
+		RemoteURL: url,
+		RefSpecs:  specs,
+		Auth:      auth,
+		Depth:     depth,
+		Tags:      settings.tags,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
+
+func (gogitBackend) listRemote(settings cloneSettings) ([]*plumbing.Reference, error) {
+	url, auth := settings.source()
+	remote := gogit.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: gogit.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	// peeled tags (<tag>^{}) say which commit an annotated tag is for
+	return remote.ListContext(settings.ctx, &gogit.ListOptions{
+		Auth:          auth,
+		PeelingOption: gogit.AppendPeeled,
+	})
+}
+
+func (gogitBackend) checkout(ctx context.Context, r *gogit.Repository, options *gogit.CheckoutOptions, sparse []string) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	dropped, err := droppedSparseFiles(r, sparse)
+	if err != nil {
+		return err
+	}
+	options.SparseCheckoutDirectories = sparse
+	err = wt.Checkout(options)
+	if err != nil {
+		return err
+	}
+	// go-git marks them skip-worktree, but leaves them behind
+	for _, name := range dropped {
+		err = util.RemoveAll(wt.Filesystem, name)
+		if err != nil {
+			return err
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if wt.Filesystem.Remove(dir) != nil {
+				// not empty (or already gone); either way, stop climbing
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// droppedSparseFiles finds files a previous checkout wrote that are outside
+// the new sparse directories.
+func droppedSparseFiles(r *gogit.Repository, sparse []string) ([]string, error) {
+	if len(sparse) == 0 {
+		return nil, nil
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	dropped := []string{}
+	for _, entry := range idx.Entries {
+		if !entry.SkipWorktree && !inSparseDirs(entry.Name, sparse) {
+			dropped = append(dropped, entry.Name)
+		}
+	}
+	return dropped, nil
+}
+
+func (gogitBackend) updateSubmodules(r *gogit.Repository, settings cloneSettings) error {
+	return updateSubmoduleTree(r, settings, settings.submodules == submodulesRecursive)
+}
+
+func (gogitBackend) createMirror(ctx context.Context, mirrorDir string, url string, auth transport.AuthMethod) error {
+	_, err := gogit.PlainCloneContext(ctx, mirrorDir, true, &gogit.CloneOptions{
+		URL:    url,
+		Auth:   auth,
+		Mirror: true,
+	})
+	return err
+}
+
+func (gogitBackend) fetchMirror(ctx context.Context, mirrorDir string, url string, auth transport.AuthMethod) error {
+	r, err := gogit.PlainOpen(mirrorDir)
+	if err != nil {
+		return err
+	}
+	err = r.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteURL: url,
+		RefSpecs:  []config.RefSpec{mirrorRefSpec},
+		Auth:      auth,
+		Prune:     true,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
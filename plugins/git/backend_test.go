@@ -0,0 +1,111 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+// TestMain runs the whole suite once per backend, since they're meant to be
+// interchangeable.
+func TestMain(m *testing.M) {
+	// the submodule tests use local paths, which git refuses by default
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+	os.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	os.Setenv("GIT_CONFIG_VALUE_0", "always")
+	// the mirror cache is on by default; keep it out of the real home
+	home, err := os.MkdirTemp("", "dpl-git-test-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unexpected error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", home)
+
+	for _, name := range []string{backendGoGit, backendExec} {
+		defaultBackend = name
+		code := m.Run()
+		if code != 0 {
+			fmt.Fprintf(os.Stderr, "%v backend failed\n", name)
+			os.RemoveAll(home)
+			os.Exit(code)
+		}
+	}
+	os.RemoveAll(home)
+}
+
+func TestGetBackend(t *testing.T) {
+	b, err := getBackend(&testcommon.ResolveComponent{
+		Data: map[string][]string{
+			backendKey: {backendExec},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := b.(execBackend); !ok {
+		t.Fatalf("Unexpected backend: %T", b)
+	}
+}
+
+func TestGetBackendInvalid(t *testing.T) {
+	_, err := getBackend(&testcommon.ResolveComponent{
+		Data: map[string][]string{
+			backendKey: {"svn"},
+		},
+	})
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+}
+
+func TestCheckoutFilter(t *testing.T) {
+	if defaultBackend != backendExec {
+		t.Skip("only the exec backend makes partial clones")
+	}
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	output, err := exec.Command("git", "-C", upstream.dir, "config", "uploadpack.allowFilter", "true").CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (%v)", err, string(output))
+	}
+
+	srcDir, err := runCheckout(t, buildInfo(upstream.dir, map[string]string{
+		filterArg: "blob:none",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := checkoutHead(t, srcDir); actual != first {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", actual, first)
+	}
+	output, err = exec.Command("git", "-C", srcDir, "config", "remote.origin.partialclonefilter").CombinedOutput()
+	if err != nil || strings.TrimSpace(string(output)) != "blob:none" {
+		t.Fatalf("Not a partial clone: %v (%v)", err, string(output))
+	}
+}
+
+func TestCheckoutFilterNeedsExec(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+		Data: map[string][]string{
+			backendKey: {backendGoGit},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		filterArg: "blob:none",
+	}))
+	if _, ok := err.(*invalidArgumentError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -1,69 +1,234 @@
 package git
 
 import (
-	// "encoding/hex"
 	"fmt"
 	"strings"
 
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
 )
 
+const (
+	minHashLength int = 4
+	maxHashLength int = 40
+)
+
 var (
-	errFoundRef       error = fmt.Errorf("found ref")
 	errCantResolveRef error = fmt.Errorf("can't resolve reference")
 )
 
-func mapRef(ref *plumbing.Reference) (*gogit.CheckoutOptions, error) {
+type ambiguousRefError struct {
+	ref     string
+	matches []string
+}
+
+func (are *ambiguousRefError) Error() string {
+	return fmt.Sprintf("ambiguous reference '%v' (matches %v)", are.ref, strings.Join(are.matches, ", "))
+}
+
+func peelHash(r *gogit.Repository, hash plumbing.Hash) (plumbing.Hash, error) {
+	tag, err := r.TagObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+		return hash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return commit.Hash, nil
+}
+
+func mapRef(r *gogit.Repository, ref *plumbing.Reference) (*gogit.CheckoutOptions, error) {
 	if ref.Name().IsBranch() {
 		return &gogit.CheckoutOptions{
 			Branch: ref.Name(),
 		}, nil
 	}
-	if ref.Name().IsTag() {
-		return &gogit.CheckoutOptions{
-			Hash: ref.Hash(),
-		}, nil
+	hash, err := peelHash(r, ref.Hash())
+	if err != nil {
+		return nil, err
 	}
-	return nil, errCantResolveRef
+	return &gogit.CheckoutOptions{
+		Hash: hash,
+	}, nil
 }
 
 func tryHappyCheckout(r *gogit.Repository, ref string) (*gogit.CheckoutOptions, error) {
 	reference, err := r.Reference(plumbing.ReferenceName(ref), true)
 	if err == nil {
-		return mapRef(reference)
+		return mapRef(r, reference)
 	}
 	return nil, errCantResolveRef
 }
 
+// shortRefName strips the namespace from a reference so the local and remote
+// tracking versions of a branch compare equal.
+func shortRefName(name plumbing.ReferenceName) string {
+	if name.IsRemote() {
+		chunks := strings.SplitN(name.Short(), "/", 2)
+		if len(chunks) == 2 {
+			return fmt.Sprintf("branch:%v", chunks[1])
+		}
+	}
+	if name.IsBranch() {
+		return fmt.Sprintf("branch:%v", name.Short())
+	}
+	if name.IsTag() {
+		return fmt.Sprintf("tag:%v", name.Short())
+	}
+	return string(name)
+}
+
+// refCandidates lists the full names a short ref could mean, the same places
+// git itself looks: local branches, tags, and each remote's branches.
+func refCandidates(r *gogit.Repository, ref string) (map[plumbing.ReferenceName]struct{}, error) {
+	remotes, err := r.Remotes()
+	if err != nil {
+		return nil, err
+	}
+	names := map[plumbing.ReferenceName]struct{}{
+		plumbing.NewBranchReferenceName(ref): {},
+		plumbing.NewTagReferenceName(ref):    {},
+	}
+	for _, remote := range remotes {
+		names[plumbing.NewRemoteReferenceName(remote.Config().Name, ref)] = struct{}{}
+	}
+	return names, nil
+}
+
 func findReference(r *gogit.Repository, ref string) (*gogit.CheckoutOptions, error) {
+	names, err := refCandidates(r, ref)
+	if err != nil {
+		return nil, err
+	}
 	refs, err := r.References()
 	if err != nil {
 		return nil, err
 	}
-	searchRef := fmt.Sprintf("/%v", ref)
-	var realRef *plumbing.Reference
+	candidates := map[string]*plumbing.Reference{}
+	matches := []string{}
 	err = refs.ForEach(func(ref *plumbing.Reference) error {
-		if strings.HasSuffix(string(ref.Name()), searchRef) {
-			realRef = ref
-			return errFoundRef
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if _, found := names[ref.Name()]; found {
+			matches = append(matches, string(ref.Name()))
+			key := shortRefName(ref.Name())
+			previous, found := candidates[key]
+			// prefer local branches over remote tracking branches
+			if !found || (previous.Name().IsRemote() && ref.Name().IsBranch()) {
+				candidates[key] = ref
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	if err == errFoundRef {
-		return mapRef(realRef)
+	if len(candidates) > 1 {
+		return nil, &ambiguousRefError{
+			ref:     ref,
+			matches: matches,
+		}
+	}
+	for _, realRef := range candidates {
+		return mapRef(r, realRef)
 	}
 	return nil, errCantResolveRef
 }
 
+func isHashPrefix(ref string) bool {
+	if len(ref) < minHashLength || len(ref) > maxHashLength {
+		return false
+	}
+	for i := range ref {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", rune(ref[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func findCommit(r *gogit.Repository, ref string) (*gogit.CheckoutOptions, error) {
+	if !isHashPrefix(ref) {
+		return nil, errCantResolveRef
+	}
+	prefix := strings.ToLower(ref)
+	if len(prefix) == maxHashLength {
+		hash := plumbing.NewHash(prefix)
+		_, err := r.CommitObject(hash)
+		if err != nil {
+			return nil, errCantResolveRef
+		}
+		return &gogit.CheckoutOptions{
+			Hash: hash,
+		}, nil
+	}
+
+	// a shared clone keeps most of its commits in the mirror
+	repos, err := alternateRepositories(r)
+	if err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	seen := map[plumbing.Hash]struct{}{}
+	for _, repo := range append([]*gogit.Repository{r}, repos...) {
+		commits, err := repo.CommitObjects()
+		if err != nil {
+			return nil, err
+		}
+		err = commits.ForEach(func(commit *object.Commit) error {
+			if _, found := seen[commit.Hash]; found {
+				return nil
+			}
+			seen[commit.Hash] = struct{}{}
+			if strings.HasPrefix(commit.Hash.String(), prefix) {
+				matches = append(matches, commit.Hash.String())
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, errCantResolveRef
+
+	case 1:
+		return &gogit.CheckoutOptions{
+			Hash: plumbing.NewHash(matches[0]),
+		}, nil
+
+	default:
+		return nil, &ambiguousRefError{
+			ref:     ref,
+			matches: matches,
+		}
+	}
+}
+
 func makeCheckoutOptions(r *gogit.Repository, info scm.ScmInfo) (*gogit.CheckoutOptions, error) {
-	targetRef, found := info.Arguments["ref"]
+	targetRef, found := info.Arguments[refArg]
 	if !found {
-		// if no ref was specified, then anything is fine
-		return &gogit.CheckoutOptions{}, nil
+		refSpec, found := info.Arguments[refSpecArg]
+		if !found {
+			// if no ref was specified, then anything is fine; stick with HEAD
+			head, err := r.Head()
+			if err != nil {
+				return nil, err
+			}
+			return mapRef(r, head)
+		}
+		// a bare refspec means whatever it fetched is what should be checked out
+		targetRef = string(parseRefSpec(refSpec).Dst(""))
 	}
 	// If ref was specified, then we need to find it.  go-git wants fully resolved references,
 	// so we'll start by hoping for the best.
@@ -73,46 +238,82 @@ func makeCheckoutOptions(r *gogit.Repository, info scm.ScmInfo) (*gogit.Checkout
 	}
 
 	// If the provided ref isn't good enough on its own, then try to turn it into a reference.
-	// This should find either a branch or tag, based on whatever pattern hits first.
+	// This should find either a branch or tag, but only if there's a single candidate.
 	options, err = findReference(r, targetRef)
-	if err == nil {
+	if err != errCantResolveRef {
 		return options, err
 	}
 
 	// If we still don't have a resolved reference, all that's left is to hope it's
-	// a commit hash (TODO in the future).
-	return nil, errCantResolveRef
-	// not a branch and not a tag, so see if we can get a hash out of it
-	// before iterating commits, make sure we can actuaully
-	/*
-		_, err = hex.DecodeString(targetRef)
-		if err != nil {
-			return nil, errCantResolveRef
+	// a (possibly abbreviated) commit hash.
+	options, err = findCommit(r, targetRef)
+	if err != nil {
+		if err == errCantResolveRef {
+			return nil, fmt.Errorf("%w '%v'", errCantResolveRef, targetRef)
 		}
+		return nil, err
+	}
+	return options, nil
+}
 
-		commits, err := r.CommitObjects()
-		if err != nil {
-			return err
+// alreadyCheckedOut reports whether HEAD is exactly what options asks for
+// and the worktree has been populated (a fresh clone has no index yet).
+// Checking it out again couldn't change anything but local work.
+func alreadyCheckedOut(r *gogit.Repository, options *gogit.CheckoutOptions) (bool, error) {
+	head, err := r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return false, err
+	}
+	if options.Branch != "" {
+		if head.Type() != plumbing.SymbolicReference || head.Target() != options.Branch {
+			return false, nil
 		}
-		var foundHash plumbing.Hash
-		err = commits.ForEach(func ())
-
-		return nil, nil
-	*/
+	} else if head.Type() != plumbing.HashReference || head.Hash() != options.Hash {
+		return false, nil
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return false, err
+	}
+	return len(idx.Entries) > 0, nil
 }
 
-func doCheckout(r *gogit.Repository, info scm.ScmInfo) error {
+// doCheckout checks out the requested ref, moving a local branch to match
+// upstream first if the update policy asks for it.  The branch update, if
+// there was one, is returned so it can be reported.
+func doCheckout(r *gogit.Repository, info scm.ScmInfo, settings cloneSettings) (*branchUpdate, error) {
 	options, err := makeCheckoutOptions(r, info)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	update, err := planBranchUpdate(r, options, info.Options.Update)
+	if err != nil {
+		return nil, err
 	}
-	wt, err := r.Worktree()
+	err = verifyCheckout(r, info, options, update, settings)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// sparse directories may have changed even if HEAD didn't, so those
+	// always go through a checkout
+	if update == nil && len(settings.sparse) == 0 {
+		current, err := alreadyCheckedOut(r, options)
+		if err != nil {
+			return nil, err
+		}
+		if current {
+			return nil, nil
+		}
 	}
-	err = wt.Checkout(options)
+	err = protectLocalChanges(r, options, update, info, settings)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if update != nil {
+		err = update.apply(r)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return update, settings.backend.checkout(settings.ctx, r, options, settings.sparse)
 }
@@ -0,0 +1,160 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func runCheckout(t *testing.T, info scm.ScmInfo) (string, error) {
+	srcDir := path.Join(t.TempDir(), "src")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return srcDir, handler.Checkout(info)
+}
+
+func checkoutExpecting(t *testing.T, info scm.ScmInfo, expected plumbing.Hash) {
+	srcDir, err := runCheckout(t, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	actual := checkoutHead(t, srcDir)
+	if actual != expected {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", actual, expected)
+	}
+}
+
+func TestCheckoutBranch(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.commit("a.txt", "second")
+	upstream.setRef("refs/heads/stable", first)
+
+	checkoutExpecting(t, buildInfo(upstream.dir, map[string]string{
+		refArg: "stable",
+	}), first)
+}
+
+func TestCheckoutAnnotatedTag(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.tag("v1.0", first)
+	upstream.commit("a.txt", "second")
+
+	checkoutExpecting(t, buildInfo(upstream.dir, map[string]string{
+		refArg: "v1.0",
+	}), first)
+}
+
+func TestCheckoutFullHash(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.commit("a.txt", "second")
+
+	checkoutExpecting(t, buildInfo(upstream.dir, map[string]string{
+		refArg: first.String(),
+	}), first)
+}
+
+func TestCheckoutShortHash(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.commit("a.txt", "second")
+
+	checkoutExpecting(t, buildInfo(upstream.dir, map[string]string{
+		refArg: first.String()[:8],
+	}), first)
+}
+
+func TestCheckoutRefSpec(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	pending := upstream.commit("a.txt", "pending")
+	// move main back so the change is only reachable through the pull ref
+	upstream.setRef("refs/pull/1/head", pending)
+	upstream.setRef("refs/heads/main", first)
+
+	checkoutExpecting(t, buildInfo(upstream.dir, map[string]string{
+		refSpecArg: "refs/pull/1/head",
+	}), pending)
+}
+
+func TestCheckoutLockedRefSpec(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	pending := upstream.commit("a.txt", "pending")
+	later := upstream.commit("a.txt", "later")
+	upstream.setRef("refs/pull/1/head", later)
+	upstream.setRef("refs/heads/main", first)
+
+	info := buildInfo(upstream.dir, map[string]string{
+		refSpecArg: "refs/pull/1/head",
+	})
+	info.Options.Revision = pending.String()
+	// the mirror fetches every ref, which would hide a dropped refspec
+	srcDir := path.Join(t.TempDir(), "src")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+		Data: map[string][]string{
+			cacheKey: {"false"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = handler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := checkoutHead(t, srcDir); actual != pending {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", actual, pending)
+	}
+}
+
+func TestCheckoutAmbiguousRef(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+	upstream.setRef("refs/heads/release", first)
+	upstream.tag("release", second)
+
+	_, err := runCheckout(t, buildInfo(upstream.dir, map[string]string{
+		refArg: "release",
+	}))
+	if _, ok := err.(*ambiguousRefError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckoutShortNameNotSuffix(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+	upstream.setRef("refs/heads/main", first)
+	upstream.setRef("refs/heads/feature/main", second)
+
+	checkoutExpecting(t, buildInfo(upstream.dir, map[string]string{
+		refArg: "main",
+	}), first)
+}
+
+func TestCheckoutMissingRef(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+
+	_, err := runCheckout(t, buildInfo(upstream.dir, map[string]string{
+		refArg: "does-not-exist",
+	}))
+	if !errors.Is(err, errCantResolveRef) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -1,28 +1,309 @@
 package git
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/go-git/go-billy/v5/osfs"
 	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
 	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
 )
 
-func gitClone(srcDir string, info scm.ScmInfo) (*gogit.Repository, error) {
-	r, err := gogit.PlainClone(srcDir, false, &gogit.CloneOptions{
-		URL:        info.Path,
-		NoCheckout: true,
+const (
+	refSpecNamespace string = "refs/dpl"
+
+	// matches git's notion of "infinite" depth, which is how a shallow
+	// repository gets converted to a complete one
+	maxDepth int = 0x7fffffff
+)
+
+type invalidArgumentError struct {
+	arg   string
+	value string
+}
+
+func (iae *invalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid value for argument '%v' (%v)", iae.arg, iae.value)
+}
+
+type cloneSettings struct {
+	// network operations give up when ctx is done
+	ctx      context.Context
+	url      string
+	auth     transport.AuthMethod
+	cacheDir string
+	mirror   string
+	depth    int
+	// partial clone filter (e.g., blob:none); only the exec backend can
+	// use it
+	filter       string
+	singleBranch bool
+	tags         gogit.TagMode
+	submodules   string
+	sparse       []string
+	// only local sources (i.e., an existing mirror) can be used
+	offline bool
+	verify  string
+	// armored keyring, only loaded when verifying signatures
+	trustedKeys string
+	backend     backend
+	// credentials for any other url (e.g., a submodule's) are looked up
+	// through component; auth only ever belongs to url
+	component dpl.Component
+}
+
+func getBoolArgument(info scm.ScmInfo, arg string, fallback bool) (bool, error) {
+	raw, found := info.Arguments[arg]
+	if !found {
+		return fallback, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, &invalidArgumentError{
+			arg:   arg,
+			value: raw,
+		}
+	}
+	return value, nil
+}
+
+func getCloneSettings(ctx context.Context, info scm.ScmInfo) (cloneSettings, error) {
+	settings := cloneSettings{
+		ctx:     ctx,
+		url:     remoteURL(info),
+		tags:    gogit.TagFollowing,
+		offline: dpl.Offline(),
+		backend: backends[defaultBackend],
+	}
+	if rawDepth, found := info.Arguments[depthArg]; found {
+		depth, err := strconv.Atoi(rawDepth)
+		if err != nil || depth < 0 {
+			return settings, &invalidArgumentError{
+				arg:   depthArg,
+				value: rawDepth,
+			}
+		}
+		settings.depth = depth
+	}
+	if filter, found := info.Arguments[filterArg]; found {
+		if len(filter) == 0 {
+			return settings, &invalidArgumentError{
+				arg:   filterArg,
+				value: filter,
+			}
+		}
+		settings.filter = filter
+	}
+
+	var err error
+	settings.submodules, err = getSubmoduleMode(info)
+	if err != nil {
+		return settings, err
+	}
+	settings.sparse, err = getSparseDirs(info)
+	if err != nil {
+		return settings, err
+	}
+	settings.verify, err = getVerifyMode(info)
+	if err != nil {
+		return settings, err
+	}
+	settings.singleBranch, err = getBoolArgument(info, singleBranchArg, false)
+	if err != nil {
+		return settings, err
+	}
+	if _, found := info.Arguments[tagsArg]; found {
+		tags, err := getBoolArgument(info, tagsArg, true)
+		if err != nil {
+			return settings, err
+		}
+		if tags {
+			settings.tags = gogit.AllTags
+		} else {
+			settings.tags = gogit.NoTags
+		}
+	}
+	return settings, nil
+}
+
+// source is where objects should come from: the local mirror if there is
+// one, otherwise upstream.
+func (cs cloneSettings) source() (string, transport.AuthMethod) {
+	if len(cs.mirror) > 0 {
+		return cs.mirror, nil
+	}
+	return cs.url, cs.auth
+}
+
+// shared is set when a clone should borrow the mirror's objects instead of
+// copying them.  A shallow clone wants its own small copy.
+func (cs cloneSettings) shared() bool {
+	return len(cs.mirror) > 0 && cs.depth == 0
+}
+
+// offlineError explains why source() can't be used, if it can't.  A mirror is
+// always local.
+func (cs cloneSettings) offlineError() error {
+	if !cs.offline || len(cs.mirror) > 0 {
+		return nil
+	}
+	return fmt.Errorf("%w (%v)", dpl.ErrOffline, cs.url)
+}
+
+// fetchDepth picks the depth for fetching into an existing repository.  A
+// shallow repository always needs a depth, otherwise the server assumes we
+// have the complete history.
+func (cs cloneSettings) fetchDepth(r *gogit.Repository) (int, error) {
+	if cs.depth != 0 {
+		return cs.depth, nil
+	}
+	shallow, err := r.Storer.Shallow()
+	if err != nil {
+		return 0, err
+	}
+	if len(shallow) > 0 {
+		return maxDepth, nil
+	}
+	return 0, nil
+}
+
+// parseRefSpec turns the refspec argument into something go-git can fetch.  A
+// bare source ref (e.g., refs/pull/1/head) is stored under refs/dpl so it
+// can't collide with branches or tags.
+func parseRefSpec(raw string) config.RefSpec {
+	if strings.Contains(raw, ":") {
+		return config.RefSpec(raw)
+	}
+	src := strings.TrimPrefix(raw, "+")
+	dst := path.Join(refSpecNamespace, strings.TrimPrefix(src, "refs/"))
+	return config.RefSpec(fmt.Sprintf("+%v:%v", src, dst))
+}
+
+func fetchRefSpecs(r *gogit.Repository, settings cloneSettings, specs []config.RefSpec) error {
+	if settings.offlineError() != nil {
+		// whatever's already here will have to do
+		return nil
+	}
+	depth, err := settings.fetchDepth(r)
+	if err != nil {
+		return err
+	}
+	return settings.backend.fetch(r, settings, specs, depth)
+}
+
+func fetchRefSpec(r *gogit.Repository, info scm.ScmInfo, settings cloneSettings) error {
+	refSpec, found := info.Arguments[refSpecArg]
+	if !found {
+		return nil
+	}
+	spec := parseRefSpec(refSpec)
+	err := spec.Validate()
+	if err != nil {
+		return err
+	}
+	return fetchRefSpecs(r, settings, []config.RefSpec{spec})
+}
+
+func listRemoteRefs(settings cloneSettings) ([]*plumbing.Reference, error) {
+	err := settings.offlineError()
+	if err != nil {
+		return nil, err
+	}
+	return settings.backend.listRemote(settings)
+}
+
+// findRemoteRef finds the name of a ref as the remote knows it.  If there's
+// no match, an empty name is returned.
+func findRemoteRef(refs []*plumbing.Reference, ref string) plumbing.ReferenceName {
+	candidates := []plumbing.ReferenceName{
+		plumbing.ReferenceName(ref),
+		plumbing.NewBranchReferenceName(ref),
+		plumbing.NewTagReferenceName(ref),
+	}
+	for _, candidate := range candidates {
+		for _, remoteRef := range refs {
+			if remoteRef.Name() == candidate {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+func gitClone(srcDir string, info scm.ScmInfo, settings cloneSettings) (*gogit.Repository, error) {
+	err := settings.offlineError()
+	if err != nil {
+		return nil, err
+	}
+	var branch plumbing.ReferenceName
+	if targetRef, found := info.Arguments[refArg]; found && settings.singleBranch {
+		refs, err := listRemoteRefs(settings)
+		if err != nil {
+			return nil, err
+		}
+		branch = findRemoteRef(refs, targetRef)
+	}
+	r, err := settings.backend.clone(srcDir, settings, branch)
+	if err != nil {
+		return nil, err
+	}
+	if settings.shared() {
+		err = registerMirrorUser(settings.mirror, srcDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(settings.mirror) > 0 {
+		return r, useMirror(r, settings.url)
+	}
+	return r, nil
+}
+
+// repositoryStorage is the object storage for the repository in repoDir.
+// Shared clones list the mirror as an absolute alternate, which go-git only
+// follows if it's given a filesystem rooted above both.
+func repositoryStorage(repoDir string) *filesystem.Storage {
+	return filesystem.NewStorageWithOptions(osfs.New(path.Join(repoDir, gogit.GitDirName)), cache.NewObjectLRUDefault(), filesystem.Options{
+		AlternatesFS: osfs.New("/"),
 	})
-	return r, err
 }
 
-func getRepository(srcDir string, info scm.ScmInfo) (*gogit.Repository, error) {
-	if offset, found := info.Arguments["path"]; found {
-		srcDir = path.Join(srcDir, offset)
+// openRepository is gogit.PlainOpen, but can read objects borrowed from a
+// mirror.
+func openRepository(repoDir string) (*gogit.Repository, error) {
+	repoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return nil, err
 	}
-	r, err := gogit.PlainOpen(srcDir)
+	fi, err := os.Stat(path.Join(repoDir, gogit.GitDirName))
+	if err != nil || !fi.IsDir() {
+		// missing, bare, or a submodule's gitdir file; none of them are
+		// shared clones
+		return gogit.PlainOpen(repoDir)
+	}
+	return gogit.Open(repositoryStorage(repoDir), osfs.New(repoDir))
+}
+
+func getRepository(srcDir string, info scm.ScmInfo, settings cloneSettings) (*gogit.Repository, error) {
+	r, err := openRepository(srcDir)
 	if err == gogit.ErrRepositoryNotExists {
-		return gitClone(srcDir, info)
+		r, err = gitClone(srcDir, info, settings)
+		if err != nil {
+			return nil, err
+		}
+		return r, fetchRefSpec(r, info, settings)
 	}
 	if err != nil {
 		// some other error
@@ -30,9 +311,9 @@ func getRepository(srcDir string, info scm.ScmInfo) (*gogit.Repository, error) {
 	}
 
 	// we've got a repo, so update it
-	err = r.Fetch(&gogit.FetchOptions{})
-	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+	err = fetchRefSpecs(r, settings, nil)
+	if err != nil {
 		return nil, err
 	}
-	return r, nil
+	return r, fetchRefSpec(r, info, settings)
 }
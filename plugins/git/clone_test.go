@@ -0,0 +1,132 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+func openRepo(t *testing.T, srcDir string) *gogit.Repository {
+	r, err := openRepository(srcDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return r
+}
+
+func countRefs(t *testing.T, iter storer.ReferenceIter) int {
+	count := 0
+	err := iter.ForEach(func(*plumbing.Reference) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return count
+}
+
+func TestShallowClone(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+
+	srcDir, err := runCheckout(t, buildInfo("file://"+upstream.dir, map[string]string{
+		depthArg: "1",
+		refArg:   "main",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := checkoutHead(t, srcDir); head != second {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", head, second)
+	}
+	shallow, err := openRepo(t, srcDir).Storer.Shallow()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(shallow) != 1 || shallow[0] != second {
+		t.Fatalf("Unexpected shallow commits: %v", shallow)
+	}
+}
+
+func TestShallowDeepenForHash(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	for _, contents := range []string{"second", "third", "fourth", "fifth"} {
+		upstream.commit("a.txt", contents)
+	}
+
+	checkoutExpecting(t, buildInfo("file://"+upstream.dir, map[string]string{
+		depthArg: "1",
+		refArg:   first.String()[:10],
+	}), first)
+}
+
+func TestShallowFetchTag(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.tag("v1", first)
+	upstream.commit("a.txt", "second")
+
+	checkoutExpecting(t, buildInfo("file://"+upstream.dir, map[string]string{
+		depthArg: "1",
+		tagsArg:  "false",
+		refArg:   "v1",
+	}), first)
+}
+
+func TestSingleBranch(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.commit("a.txt", "second")
+	upstream.setRef("refs/heads/stable", first)
+
+	info := buildInfo("file://"+upstream.dir, map[string]string{
+		singleBranchArg: "true",
+		refArg:          "stable",
+	})
+	srcDir, err := runCheckout(t, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := checkoutHead(t, srcDir); head != first {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", head, first)
+	}
+	r := openRepo(t, srcDir)
+	if _, err := r.Reference(plumbing.NewRemoteReferenceName("origin", "main"), false); err == nil {
+		t.Fatalf("Unexpected remote branch for main")
+	}
+}
+
+func TestNoTags(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.tag("v1", first)
+
+	srcDir, err := runCheckout(t, buildInfo("file://"+upstream.dir, map[string]string{
+		tagsArg: "false",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tags, err := openRepo(t, srcDir).Tags()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count := countRefs(t, tags); count != 0 {
+		t.Fatalf("Unexpected tag count: %v", count)
+	}
+}
+
+func TestInvalidDepth(t *testing.T) {
+	_, err := getCloneSettings(context.Background(), buildInfo("", map[string]string{
+		depthArg: "-1",
+	}))
+	if _, ok := err.(*invalidArgumentError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package git
+
+import (
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dev-pipeline/dpl-go/cmd"
+)
+
+type pruneFlags struct {
+	CacheDir  string
+	OlderThan time.Duration
+	DryRun    bool
+}
+
+var (
+	gitPruneFlags pruneFlags
+
+	gitCacheCmd = &cobra.Command{
+		Use:   "git",
+		Short: "Manage the git mirror cache",
+	}
+
+	gitPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove git mirrors that haven't been used recently",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pruneMirrors(gitPruneFlags)
+		},
+	}
+)
+
+func pruneMirror(mirrorDir string, flags pruneFlags) error {
+	lastUsed, err := mirrorLastUsed(mirrorDir)
+	if err != nil {
+		return err
+	}
+	if time.Since(lastUsed) < flags.OlderThan {
+		return nil
+	}
+	lock, err := tryLockMirror(mirrorDir)
+	if err != nil {
+		if err == errMirrorBusy {
+			log.Printf("Skipping %v (in use)", mirrorDir)
+			return nil
+		}
+		return err
+	}
+	defer lock.Unlock()
+
+	// clones read objects straight out of the mirror, so it has to outlive them
+	users, err := mirrorUsers(mirrorDir)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		log.Printf("Skipping %v (shared with %v)", mirrorDir, strings.Join(users, ", "))
+		return nil
+	}
+
+	log.Printf("Removing %v (last used %v)", mirrorDir, lastUsed.Format(time.RFC3339))
+	if flags.DryRun {
+		return nil
+	}
+	// the lock file stays: anyone already waiting on it holds the old inode,
+	// and removing it would let a newcomer lock a fresh one at the same time
+	return os.RemoveAll(mirrorDir)
+}
+
+func pruneMirrors(flags pruneFlags) error {
+	cacheDir := flags.CacheDir
+	if len(cacheDir) == 0 {
+		var err error
+		cacheDir, err = defaultCacheDir()
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for i := range entries {
+		if entries[i].IsDir() && strings.HasSuffix(entries[i].Name(), mirrorSuffix) {
+			err = pruneMirror(path.Join(cacheDir, entries[i].Name()), flags)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	gitPruneCmd.PersistentFlags().StringVar(&gitPruneFlags.CacheDir, "cache-dir", "",
+		"Mirror cache directory (defaults to ~/.dev-pipeline/git-cache)")
+	gitPruneCmd.PersistentFlags().DurationVar(&gitPruneFlags.OlderThan, "older-than", 30*24*time.Hour,
+		"Remove mirrors that haven't been used for this long")
+	gitPruneCmd.PersistentFlags().BoolVar(&gitPruneFlags.DryRun, "dry-run", false,
+		"Report which mirrors would be removed without removing them")
+	gitCacheCmd.AddCommand(gitPruneCmd)
+	cmd.AddCacheCommand(gitCacheCmd)
+}
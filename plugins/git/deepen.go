@@ -0,0 +1,86 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func makeFetchSpec(name plumbing.ReferenceName) config.RefSpec {
+	if name.IsBranch() {
+		return config.RefSpec(fmt.Sprintf("+%v:%v", name, plumbing.NewRemoteReferenceName(gogit.DefaultRemoteName, name.Short())))
+	}
+	if name.IsTag() {
+		return config.RefSpec(fmt.Sprintf("+%v:%v", name, name))
+	}
+	return parseRefSpec(string(name))
+}
+
+func refResolves(r *gogit.Repository, info scm.ScmInfo) bool {
+	_, err := makeCheckoutOptions(r, info)
+	return !errors.Is(err, errCantResolveRef)
+}
+
+// deepenHistory keeps fetching more history until the target commit shows up
+// or there's nothing left to fetch.
+func deepenHistory(r *gogit.Repository, info scm.ScmInfo, settings cloneSettings) error {
+	depth := settings.depth
+	if depth < 1 {
+		depth = 1
+	}
+	for {
+		shallow, err := r.Storer.Shallow()
+		if err != nil {
+			return err
+		}
+		if len(shallow) == 0 || depth >= maxDepth {
+			return nil
+		}
+		depth = min(depth*2, maxDepth)
+		deeper := settings
+		deeper.depth = depth
+		err = fetchRefSpecs(r, deeper, nil)
+		if err != nil {
+			return err
+		}
+		if refResolves(r, info) {
+			return nil
+		}
+	}
+}
+
+// fetchMissingRef handles refs that weren't part of a shallow or single-branch
+// clone.  Named refs are fetched directly; anything else is assumed to be a
+// commit somewhere in history.
+func fetchMissingRef(r *gogit.Repository, info scm.ScmInfo, settings cloneSettings) error {
+	targetRef, found := info.Arguments[refArg]
+	if !found || refResolves(r, info) {
+		return nil
+	}
+	err := settings.offlineError()
+	if err != nil {
+		return fmt.Errorf("%w '%v': %w", errCantResolveRef, targetRef, err)
+	}
+
+	refs, err := listRemoteRefs(settings)
+	if err != nil {
+		return err
+	}
+	name := findRemoteRef(refs, targetRef)
+	if name != "" {
+		err = fetchRefSpecs(r, settings, []config.RefSpec{makeFetchSpec(name)})
+	} else {
+		err = deepenHistory(r, info, settings)
+	}
+	if err == nil && settings.offline && !refResolves(r, info) {
+		// only the mirror was searched, and it wasn't refreshed
+		return fmt.Errorf("%w '%v': %w", errCantResolveRef, targetRef, dpl.ErrOffline)
+	}
+	return err
+}
@@ -0,0 +1,385 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+type gitCommandError struct {
+	args   []string
+	err    error
+	output string
+}
+
+func (gce *gitCommandError) Error() string {
+	return fmt.Sprintf("git %v failed: %v (%v)", strings.Join(gce.args, " "), gce.err, gce.output)
+}
+
+func (gce *gitCommandError) Unwrap() error {
+	return gce.err
+}
+
+var (
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// shellQuote makes value safe to paste into GIT_SSH_COMMAND, which git runs
+// through the shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// basicAuthEnv passes http credentials to git as an extra header.  It goes
+// through the environment so the secret doesn't show up in the process
+// list.
+func basicAuthEnv(basic *http.BasicAuth) ([]string, error) {
+	count := 0
+	if rawCount := os.Getenv("GIT_CONFIG_COUNT"); len(rawCount) > 0 {
+		var err error
+		count, err = strconv.Atoi(rawCount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GIT_CONFIG_COUNT (%v)", rawCount)
+		}
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v:%v", basic.Username, basic.Password)))
+	return []string{
+		fmt.Sprintf("GIT_CONFIG_KEY_%v=http.extraHeader", count),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%v=Authorization: Basic %v", count, credentials),
+		fmt.Sprintf("GIT_CONFIG_COUNT=%v", count+1),
+	}, nil
+}
+
+// sshEnv points ssh at the same key and known hosts go-git would use.  A
+// passphrase is read by an askpass script straight from the variable it's
+// already in, so the secret never lands on disk or in the process list.
+// The returned function removes the script.
+func sshEnv(auth *sshAuth) ([]string, func(), error) {
+	noop := func() {}
+	if len(auth.keyFile) == 0 && len(auth.knownHosts) == 0 {
+		return nil, noop, nil
+	}
+	command := os.Getenv("GIT_SSH_COMMAND")
+	if len(command) == 0 {
+		command = "ssh"
+	}
+	if len(auth.keyFile) > 0 {
+		command += " -o IdentitiesOnly=yes -i " + shellQuote(auth.keyFile)
+	}
+	if len(auth.knownHosts) > 0 {
+		files := []string{}
+		for _, knownHosts := range auth.knownHosts {
+			files = append(files, fmt.Sprintf("%q", knownHosts))
+		}
+		command += " -o " + shellQuote("UserKnownHostsFile "+strings.Join(files, " ")) + " -o StrictHostKeyChecking=yes"
+	}
+	env := []string{"GIT_SSH_COMMAND=" + command}
+	if len(auth.passphraseEnv) == 0 {
+		return env, noop, nil
+	}
+	if !envNamePattern.MatchString(auth.passphraseEnv) {
+		return nil, noop, fmt.Errorf("invalid passphrase environment variable (%v)", auth.passphraseEnv)
+	}
+	script, err := os.CreateTemp("", "dpl-askpass-")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		os.Remove(script.Name())
+	}
+	_, err = fmt.Fprintf(script, "#!/bin/sh\nprintf '%%s\\n' \"$%v\"\n", auth.passphraseEnv)
+	if err == nil {
+		err = script.Chmod(0700)
+	}
+	if closeErr := script.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	return append(env, "SSH_ASKPASS="+script.Name(), "SSH_ASKPASS_REQUIRE=force"), cleanup, nil
+}
+
+// authEnv translates auth into whatever git needs to use it.  The returned
+// function cleans up after the command finishes.
+func authEnv(auth transport.AuthMethod) ([]string, func(), error) {
+	switch auth := auth.(type) {
+	case *http.BasicAuth:
+		if auth != nil {
+			env, err := basicAuthEnv(auth)
+			return env, func() {}, err
+		}
+
+	case *sshAuth:
+		if auth != nil {
+			return sshEnv(auth)
+		}
+	}
+	return nil, func() {}, nil
+}
+
+// execGit runs the system git binary in dir, returning what it wrote to
+// stdout.  It never prompts; a build with nobody watching would just hang.
+func execGit(ctx context.Context, dir string, auth transport.AuthMethod, args ...string) ([]byte, error) {
+	env, cleanup, err := authEnv(auth)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, &gitCommandError{
+			args:   args,
+			err:    err,
+			output: strings.TrimSpace(stderr.String()),
+		}
+	}
+	return stdout.Bytes(), nil
+}
+
+// tagArgs maps go-git's tag modes onto git's flags.  Following tags is what
+// git does anyway.
+func tagArgs(tags gogit.TagMode) []string {
+	switch tags {
+	case gogit.AllTags:
+		return []string{"--tags"}
+
+	case gogit.NoTags:
+		return []string{"--no-tags"}
+	}
+	return nil
+}
+
+// execBackend shells out to git, for the cases go-git can't handle well
+// (large repositories, partial clones, unusual transports, or credential
+// helpers).  Token
+// and netrc credentials are passed along, as are the ssh key and known hosts
+// settings; anything else is left to git's own configuration.
+type execBackend struct{}
+
+func (execBackend) clone(srcDir string, settings cloneSettings, branch plumbing.ReferenceName) (*gogit.Repository, error) {
+	url, auth := settings.source()
+	args := []string{"clone", "--no-checkout", "--quiet"}
+	if settings.depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(settings.depth))
+	}
+	if len(settings.filter) > 0 {
+		args = append(args, "--filter="+settings.filter)
+	}
+	// git ignores depth and filters for plain paths, since it'd rather
+	// hardlink everything
+	if (settings.depth > 0 || len(settings.filter) > 0) && path.IsAbs(url) {
+		url = "file://" + url
+	}
+	if settings.singleBranch {
+		args = append(args, "--single-branch")
+	}
+	if branch.IsBranch() || branch.IsTag() {
+		args = append(args, "--branch", branch.Short())
+	}
+	if settings.tags == gogit.NoTags {
+		args = append(args, "--no-tags")
+	}
+	if settings.shared() {
+		args = append(args, "--shared")
+	}
+	args = append(args, "--", url, srcDir)
+	_, err := execGit(settings.ctx, "", auth, args...)
+	if err != nil {
+		return nil, err
+	}
+	return openRepository(srcDir)
+}
+
+func (execBackend) fetch(r *gogit.Repository, settings cloneSettings, specs []config.RefSpec, depth int) error {
+	if len(specs) == 0 {
+		remote, err := r.Remote(gogit.DefaultRemoteName)
+		if err != nil {
+			return err
+		}
+		specs = remote.Config().Fetch
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	url, auth := settings.source()
+	args := []string{"fetch", "--quiet"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	if len(settings.filter) > 0 {
+		args = append(args, "--filter="+settings.filter)
+	}
+	args = append(args, tagArgs(settings.tags)...)
+	args = append(args, "--", url)
+	for _, spec := range specs {
+		args = append(args, spec.String())
+	}
+	_, err = execGit(settings.ctx, wt.Filesystem.Root(), auth, args...)
+	return err
+}
+
+func (execBackend) listRemote(settings cloneSettings) ([]*plumbing.Reference, error) {
+	url, auth := settings.source()
+	output, err := execGit(settings.ctx, "", auth, "ls-remote", "--symref", "--", url)
+	if err != nil {
+		return nil, err
+	}
+	refs := []*plumbing.Reference{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// peeled tags (<tag>^{}) are kept, as the go-git backend does
+		value, name, found := strings.Cut(scanner.Text(), "\t")
+		if !found {
+			continue
+		}
+		if target, symbolic := strings.CutPrefix(value, "ref: "); symbolic {
+			refs = append(refs, plumbing.NewSymbolicReference(plumbing.ReferenceName(name), plumbing.ReferenceName(target)))
+		} else {
+			refs = append(refs, plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(value)))
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// checkout forces the worktree to match options.  Local changes have
+// already been dealt with by the time this runs, and forcing is what makes
+// git refresh the worktree when the current branch was moved underneath it.
+func (execBackend) checkout(ctx context.Context, r *gogit.Repository, options *gogit.CheckoutOptions, sparse []string) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	root := wt.Filesystem.Root()
+	if len(sparse) > 0 {
+		args := []string{"sparse-checkout", "set", "--no-cone"}
+		for _, dir := range sparse {
+			args = append(args, fmt.Sprintf("/%v/", dir))
+		}
+		_, err = execGit(ctx, root, nil, args...)
+		if err != nil {
+			return err
+		}
+	}
+	if options.Branch != "" {
+		_, err = execGit(ctx, root, nil, "checkout", "--quiet", "--force", options.Branch.Short(), "--")
+	} else {
+		_, err = execGit(ctx, root, nil, "checkout", "--quiet", "--force", "--detach", options.Hash.String(), "--")
+	}
+	return err
+}
+
+// submodulePaths lists the submodules .gitmodules declares in dir, by name.
+func submodulePaths(ctx context.Context, dir string) (map[string]string, error) {
+	_, err := os.Stat(path.Join(dir, ".gitmodules"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	output, err := execGit(ctx, dir, nil, "config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, value, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		paths[name] = value
+	}
+	return paths, nil
+}
+
+// execUpdateSubmoduleTree updates one submodule at a time so each fetch only
+// carries the credentials for its own url.
+func execUpdateSubmoduleTree(dir string, settings cloneSettings, recurse bool) error {
+	paths, err := submodulePaths(settings.ctx, dir)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		subPath := paths[name]
+		_, err = execGit(settings.ctx, dir, nil, "submodule", "--quiet", "init", "--", subPath)
+		if err != nil {
+			return err
+		}
+		// init resolves relative urls, so read it back rather than using
+		// .gitmodules
+		output, err := execGit(settings.ctx, dir, nil, "config", "--get", fmt.Sprintf("submodule.%v.url", name))
+		if err != nil {
+			return err
+		}
+		auth, err := getAuth(settings.component, strings.TrimSpace(string(output)))
+		if err != nil {
+			return err
+		}
+		args := []string{"submodule", "--quiet", "update"}
+		if settings.offline {
+			args = append(args, "--no-fetch")
+		}
+		_, err = execGit(settings.ctx, dir, auth, append(args, "--", subPath)...)
+		if err != nil {
+			return err
+		}
+		if recurse {
+			err = execUpdateSubmoduleTree(path.Join(dir, subPath), settings, recurse)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateSubmodules lets git do the fetching and checking out.  Submodules
+// don't go through the mirror cache with this backend.
+func (execBackend) updateSubmodules(r *gogit.Repository, settings cloneSettings) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return execUpdateSubmoduleTree(wt.Filesystem.Root(), settings, settings.submodules == submodulesRecursive)
+}
+
+func (execBackend) createMirror(ctx context.Context, mirrorDir string, url string, auth transport.AuthMethod) error {
+	_, err := execGit(ctx, "", auth, "clone", "--mirror", "--quiet", "--", url, mirrorDir)
+	return err
+}
+
+func (execBackend) fetchMirror(ctx context.Context, mirrorDir string, url string, auth transport.AuthMethod) error {
+	_, err := execGit(ctx, mirrorDir, auth, "fetch", "--prune", "--quiet", "--", url, mirrorRefSpec.String())
+	return err
+}
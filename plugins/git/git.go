@@ -1,23 +1,129 @@
 package git
 
 import (
+	"context"
 	"log"
 
 	"github.com/dev-pipeline/dpl-go/pkg/dpl"
 	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
 )
 
+const (
+	depthArg        string = "depth"
+	filterArg       string = "filter"
+	pathArg         string = "path"
+	refArg          string = "ref"
+	refSpecArg      string = "refspec"
+	singleBranchArg string = "single_branch"
+	sparseArg       string = "sparse"
+	submodulesArg   string = "submodules"
+	tagPrefixArg    string = "tag_prefix"
+	tagsArg         string = "tags"
+	verifyArg       string = "verify"
+)
+
 type gitHandler struct {
 	component dpl.Component
 }
 
+// pinRevision replaces the configured ref with a locked revision, leaving the
+// caller's arguments alone.  A refspec is kept, since the locked commit may
+// only be reachable through it (e.g., refs/pull/*).
+func pinRevision(info scm.ScmInfo) scm.ScmInfo {
+	if len(info.Options.Revision) == 0 {
+		return info
+	}
+	arguments := map[string]string{}
+	for k, v := range info.Arguments {
+		arguments[k] = v
+	}
+	arguments[refArg] = info.Options.Revision
+	info.Arguments = arguments
+	return info
+}
+
 func (gh *gitHandler) Checkout(info scm.ScmInfo) error {
-	r, err := getRepository(gh.component.GetSourceDir(), info)
+	return gh.CheckoutContext(context.Background(), info)
+}
+
+func (gh *gitHandler) CheckoutContext(ctx context.Context, info scm.ScmInfo) error {
+	info = pinRevision(info)
+	settings, err := getCloneSettings(ctx, info)
+	if err != nil {
+		return err
+	}
+	repoDir, err := repositoryDir(gh.component, info)
+	if err != nil {
+		return err
+	}
+	if info.Options.Update == scm.UpdateNever && len(info.Options.Revision) == 0 {
+		_, err := openRepository(repoDir)
+		if err == nil {
+			return nil
+		}
+	}
+	settings.backend, err = getBackend(gh.component)
+	if err != nil {
+		return err
+	}
+	settings.component = gh.component
+	settings.auth, err = getAuth(gh.component, settings.url)
+	if err != nil {
+		return err
+	}
+	if settings.verify == verifySigned {
+		settings.trustedKeys, err = getTrustedKeys(gh.component)
+		if err != nil {
+			return err
+		}
+	}
+	if len(settings.filter) > 0 {
+		if _, ok := settings.backend.(execBackend); !ok {
+			// go-git can't make partial clones
+			return &invalidArgumentError{
+				arg:   filterArg,
+				value: settings.filter,
+			}
+		}
+	}
+	settings.cacheDir, err = getCacheDir(gh.component)
+	if err != nil {
+		return err
+	}
+	// a mirror holds every object, which is what a partial clone is
+	// trying to avoid
+	if len(settings.cacheDir) > 0 && len(settings.filter) == 0 {
+		var lock *mirrorLock
+		settings.mirror, lock, err = updateMirror(settings)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+	info, resolvedRef, err := resolveSemverRef(info, settings, repoDir)
+	if err != nil {
+		return err
+	}
+	if len(resolvedRef) > 0 {
+		setResolvedRef(gh.component, info, resolvedRef)
+	}
+	r, err := getRepository(repoDir, info, settings)
+	if err != nil {
+		return err
+	}
+	err = fetchMissingRef(r, info, settings)
+	if err != nil {
+		return err
+	}
+	update, err := doCheckout(r, info, settings)
+	if err != nil {
+		return err
+	}
+	err = reportUpdate(r, gh.component.Name(), update)
 	if err != nil {
 		return err
 	}
-	err = doCheckout(r, info)
-	return err
+	return updateSubmodules(r, settings)
 }
 
 func makeGit(component dpl.Component) (scm.ScmHandler, error) {
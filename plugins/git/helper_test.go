@@ -0,0 +1,116 @@
+package git
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+type upstreamRepo struct {
+	t    *testing.T
+	dir  string
+	repo *gogit.Repository
+	// commits and tags are signed with this, if it's set
+	signKey *openpgp.Entity
+}
+
+var (
+	testSignature = object.Signature{
+		Name:  "dpl",
+		Email: "dpl@example.com",
+		When:  time.Unix(1700000000, 0),
+	}
+)
+
+func makeUpstream(t *testing.T) *upstreamRepo {
+	dir := t.TempDir()
+	r, err := gogit.PlainInitWithOptions(dir, &gogit.PlainInitOptions{
+		InitOptions: gogit.InitOptions{
+			DefaultBranch: plumbing.Main,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return &upstreamRepo{
+		t:    t,
+		dir:  dir,
+		repo: r,
+	}
+}
+
+func (ur *upstreamRepo) commit(filename string, contents string) plumbing.Hash {
+	err := os.MkdirAll(path.Dir(path.Join(ur.dir, filename)), 0755)
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(path.Join(ur.dir, filename), []byte(contents), 0644)
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+	wt, err := ur.repo.Worktree()
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = wt.Add(filename)
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+	hash, err := wt.Commit(contents, &gogit.CommitOptions{
+		Author:  &testSignature,
+		SignKey: ur.signKey,
+	})
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+	return hash
+}
+
+func (ur *upstreamRepo) setRef(name string, hash plumbing.Hash) {
+	err := ur.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), hash))
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func (ur *upstreamRepo) tag(name string, hash plumbing.Hash) {
+	_, err := ur.repo.CreateTag(name, hash, &gogit.CreateTagOptions{
+		Tagger:  &testSignature,
+		Message: name,
+		SignKey: ur.signKey,
+	})
+	if err != nil {
+		ur.t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func buildInfo(upstream string, arguments map[string]string) scm.ScmInfo {
+	if arguments == nil {
+		arguments = map[string]string{}
+	}
+	return scm.ScmInfo{
+		Scheme:    "git",
+		Path:      upstream,
+		Arguments: arguments,
+	}
+}
+
+func checkoutHead(t *testing.T, srcDir string) plumbing.Hash {
+	r, err := openRepository(srcDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return head.Hash()
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package git
+
+import (
+	"fmt"
+)
+
+const (
+	// without locking, mirrors can't be shared safely, so the cache is opt-in
+	mirrorLocking bool = false
+)
+
+var (
+	errMirrorBusy       error = fmt.Errorf("mirror is in use")
+	errLockNotSupported error = fmt.Errorf("git mirror cache isn't supported on this platform")
+)
+
+type mirrorLock struct {
+}
+
+func lockMirror(string, bool) (*mirrorLock, error) {
+	return nil, errLockNotSupported
+}
+
+func tryLockMirror(string) (*mirrorLock, error) {
+	return nil, errLockNotSupported
+}
+
+func (ml *mirrorLock) share() error {
+	return errLockNotSupported
+}
+
+func (ml *mirrorLock) Unlock() error {
+	return nil
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const (
+	mirrorLocking bool = true
+)
+
+var (
+	errMirrorBusy error = fmt.Errorf("mirror is in use")
+)
+
+type mirrorLock struct {
+	f *os.File
+}
+
+func openLock(mirrorDir string) (*os.File, error) {
+	return os.OpenFile(fmt.Sprintf("%v%v", mirrorDir, lockSuffix), os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func lockMirror(mirrorDir string, exclusive bool) (*mirrorLock, error) {
+	f, err := openLock(mirrorDir)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &mirrorLock{
+		f: f,
+	}, nil
+}
+
+// tryLockMirror takes an exclusive lock without waiting; errMirrorBusy means
+// someone else is using the mirror.
+func tryLockMirror(mirrorDir string) (*mirrorLock, error) {
+	f, err := openLock(mirrorDir)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errMirrorBusy
+		}
+		return nil, err
+	}
+	return &mirrorLock{
+		f: f,
+	}, nil
+}
+
+func (ml *mirrorLock) share() error {
+	return syscall.Flock(int(ml.f.Fd()), syscall.LOCK_SH)
+}
+
+func (ml *mirrorLock) Unlock() error {
+	err := syscall.Flock(int(ml.f.Fd()), syscall.LOCK_UN)
+	closeErr := ml.f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,240 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+)
+
+const (
+	cacheKey    string = "scm.git.cache"
+	cacheDirKey string = "scm.git.cache_dir"
+
+	mirrorSuffix     string = ".git"
+	lockSuffix       string = ".lock"
+	lastUsedFilename string = "dpl-last-used"
+	// repositories that were cloned with the mirror as an alternate
+	usersFilename   string = "dpl-users"
+	maxMirrorPrefix int    = 64
+)
+
+var (
+	unsafeMirrorChars *regexp.Regexp
+
+	mirrorRefSpec config.RefSpec = "+refs/*:refs/*"
+)
+
+func defaultCacheDir() (string, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(homedir, ".dev-pipeline", "git-cache"), nil
+}
+
+func getCacheDir(component dpl.Component) (string, error) {
+	// on wherever mirrors can be locked
+	rawUseCache, err := dpl.GetSingleComponentValueOrDefault(component, cacheKey, strconv.FormatBool(mirrorLocking))
+	if err != nil {
+		return "", err
+	}
+	useCache, err := strconv.ParseBool(rawUseCache)
+	if err != nil {
+		return "", err
+	}
+	if !useCache {
+		return "", nil
+	}
+	fallback, err := defaultCacheDir()
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := dpl.GetSingleComponentValueOrDefault(component, cacheDirKey, fallback)
+	if err != nil {
+		return "", err
+	}
+	return expandHome(cacheDir)
+}
+
+// mirrorPath maps a URL to its mirror.  The readable prefix is only there to
+// help humans poking around; the hash is what keeps mirrors apart.
+func mirrorPath(cacheDir string, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	prefix := unsafeMirrorChars.ReplaceAllString(url, "-")
+	if len(prefix) > maxMirrorPrefix {
+		prefix = prefix[len(prefix)-maxMirrorPrefix:]
+	}
+	return path.Join(cacheDir, fmt.Sprintf("%v-%v%v", prefix, hex.EncodeToString(sum[:6]), mirrorSuffix))
+}
+
+func touchMirror(mirrorDir string) error {
+	return os.WriteFile(path.Join(mirrorDir, lastUsedFilename), []byte(time.Now().UTC().Format(time.RFC3339)), 0644)
+}
+
+func mirrorLastUsed(mirrorDir string) (time.Time, error) {
+	info, err := os.Stat(path.Join(mirrorDir, lastUsedFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			info, err = os.Stat(mirrorDir)
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return info.ModTime(), nil
+}
+
+// registerMirrorUser notes that repoDir borrows objects from the mirror, so
+// pruning can tell the mirror is still needed.
+func registerMirrorUser(mirrorDir string, repoDir string) error {
+	f, err := os.OpenFile(path.Join(mirrorDir, usersFilename), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, repoDir)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mirrorUsers lists the registered repositories that still have the mirror
+// as an alternate.  Deleted or re-cloned build directories drop out.
+func mirrorUsers(mirrorDir string) ([]string, error) {
+	contents, err := os.ReadFile(path.Join(mirrorDir, usersFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	users := []string{}
+	seen := map[string]struct{}{}
+	for _, repoDir := range strings.Split(string(contents), "\n") {
+		if _, found := seen[repoDir]; found || len(repoDir) == 0 {
+			continue
+		}
+		seen[repoDir] = struct{}{}
+		alternates, err := os.ReadFile(path.Join(repoDir, ".git", "objects", "info", "alternates"))
+		if err != nil {
+			continue
+		}
+		for _, alternate := range strings.Split(string(alternates), "\n") {
+			if path.Clean(alternate) == mirrorDir || path.Dir(path.Clean(alternate)) == mirrorDir {
+				users = append(users, repoDir)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+// alternateRepositories opens the repositories r borrows objects from.  Object
+// iterators only walk r's own objects, so anything that scans them has to
+// look here too.
+func alternateRepositories(r *gogit.Repository) ([]*gogit.Repository, error) {
+	s, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, nil
+	}
+	contents, err := os.ReadFile(path.Join(s.Filesystem().Root(), "objects", "info", "alternates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	repos := []*gogit.Repository{}
+	for _, alternate := range strings.Split(string(contents), "\n") {
+		if !path.IsAbs(alternate) {
+			continue
+		}
+		alt, err := gogit.PlainOpen(path.Dir(path.Clean(alternate)))
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, alt)
+	}
+	return repos, nil
+}
+
+// updateMirror brings the mirror for url up to date with upstream and returns
+// its path.  Offline, an existing mirror is used as is, and a missing one
+// gives an empty path.  The returned lock is shared so other tasks can read from the
+// mirror, but nothing can update or prune it until the lock is released.
+func updateMirror(settings cloneSettings) (string, *mirrorLock, error) {
+	err := os.MkdirAll(settings.cacheDir, 0755)
+	if err != nil {
+		return "", nil, err
+	}
+	mirrorDir := mirrorPath(settings.cacheDir, settings.url)
+	lock, err := lockMirror(mirrorDir, true)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = os.Stat(mirrorDir)
+	switch {
+	case os.IsNotExist(err) && settings.offline:
+		// nothing cached to fall back on
+		mirrorDir = ""
+		err = nil
+
+	case os.IsNotExist(err):
+		err = settings.backend.createMirror(settings.ctx, mirrorDir, settings.url, settings.auth)
+		if err != nil {
+			// don't leave a half-populated mirror behind for the next run to trip on
+			os.RemoveAll(mirrorDir)
+		}
+
+	case err == nil && !settings.offline:
+		err = settings.backend.fetchMirror(settings.ctx, mirrorDir, settings.url, settings.auth)
+	}
+	if err == nil && len(mirrorDir) > 0 {
+		err = touchMirror(mirrorDir)
+	}
+	if err == nil {
+		err = lock.share()
+	}
+	if err != nil {
+		lock.Unlock()
+		return "", nil, err
+	}
+	return mirrorDir, lock, nil
+}
+
+// useMirror points the origin remote of a fresh clone back at upstream, so
+// the repository looks normal to anyone using git directly.
+func useMirror(r *gogit.Repository, url string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	remote, found := cfg.Remotes[gogit.DefaultRemoteName]
+	if !found {
+		return nil
+	}
+	remote.URLs = []string{url}
+	return r.SetConfig(cfg)
+}
+
+func init() {
+	var err error
+	unsafeMirrorChars, err = regexp.Compile(`[^a-zA-Z0-9_.]+`)
+	if err != nil {
+		log.Fatalf("Error compiling pattern: %v", err)
+	}
+}
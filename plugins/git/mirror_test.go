@@ -0,0 +1,162 @@
+package git
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func makeCachedHandler(t *testing.T, cacheDir string) (*gitHandler, string) {
+	srcDir := path.Join(t.TempDir(), "src")
+	return &gitHandler{
+		component: &testcommon.ResolveComponent{
+			Data: map[string][]string{
+				cacheKey:    {"true"},
+				cacheDirKey: {cacheDir},
+			},
+			SourceDir: srcDir,
+		},
+	}, srcDir
+}
+
+func TestMirrorCheckout(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	cacheDir := t.TempDir()
+
+	handler, srcDir := makeCachedHandler(t, cacheDir)
+	info := buildInfo(upstream.dir, nil)
+	err := handler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mirrorDir := mirrorPath(cacheDir, upstream.dir)
+	if _, err := os.Stat(mirrorDir); err != nil {
+		t.Fatalf("Missing mirror: %v", err)
+	}
+	url, err := submoduleURL(openRepo(t, srcDir))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if url != upstream.dir {
+		t.Fatalf("Unexpected origin url: %v", url)
+	}
+
+	// a second build dir should be populated from the mirror, which in turn
+	// picks up the new commit from upstream
+	second := upstream.commit("a.txt", "second")
+	otherHandler, otherSrcDir := makeCachedHandler(t, cacheDir)
+	info.Arguments[refArg] = second.String()
+	err = otherHandler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := checkoutHead(t, otherSrcDir); head != second {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", head, second)
+	}
+	if _, err := openRepo(t, mirrorDir).CommitObject(second); err != nil {
+		t.Fatalf("Mirror is missing commit: %v", err)
+	}
+}
+
+func TestMirrorShared(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	cacheDir := t.TempDir()
+
+	handler, srcDir := makeCachedHandler(t, cacheDir)
+	err := handler.Checkout(buildInfo(upstream.dir, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mirrorDir := mirrorPath(cacheDir, upstream.dir)
+	users, err := mirrorUsers(mirrorDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(users) != 1 || users[0] != srcDir {
+		t.Fatalf("Unexpected mirror users: %v", users)
+	}
+	// nothing should have been copied out of the mirror
+	packs, err := os.ReadDir(path.Join(srcDir, ".git", "objects", "pack"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, pack := range packs {
+		if strings.HasSuffix(pack.Name(), ".pack") {
+			t.Fatalf("Objects were copied: %v", pack.Name())
+		}
+	}
+}
+
+func TestPruneMirrors(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	cacheDir := t.TempDir()
+
+	handler, srcDir := makeCachedHandler(t, cacheDir)
+	err := handler.Checkout(buildInfo(upstream.dir, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mirrorDir := mirrorPath(cacheDir, upstream.dir)
+
+	flags := pruneFlags{
+		CacheDir:  cacheDir,
+		OlderThan: time.Hour,
+	}
+	err = pruneMirrors(flags)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(mirrorDir); err != nil {
+		t.Fatalf("Recently used mirror was pruned: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(path.Join(mirrorDir, lastUsedFilename), old, old)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lock, err := lockMirror(mirrorDir, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = pruneMirrors(flags)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(mirrorDir); err != nil {
+		t.Fatalf("Mirror in use was pruned: %v", err)
+	}
+	lock.Unlock()
+
+	// the checkout borrows the mirror's objects, so it has to go first
+	err = pruneMirrors(flags)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(mirrorDir); err != nil {
+		t.Fatalf("Shared mirror was pruned: %v", err)
+	}
+	err = os.RemoveAll(srcDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = pruneMirrors(flags)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(mirrorDir); !os.IsNotExist(err) {
+		t.Fatalf("Unused mirror wasn't pruned: %v", err)
+	}
+	// anyone queued on the lock must still be locking the same file
+	if _, err := os.Stat(mirrorDir + lockSuffix); err != nil {
+		t.Fatalf("Lock file was removed: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func TestOfflineSkipsFetch(t *testing.T) {
+	ut := makeUpdateTest(t)
+	first := checkoutHead(t, ut.srcDir)
+	ut.upstream.commit("a.txt", "second")
+	t.Setenv(dpl.OfflineEnv, "1")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut.expectHead(first)
+}
+
+func TestOfflineMissingRef(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.upstream.tag("v2", ut.upstream.commit("a.txt", "second"))
+	t.Setenv(dpl.OfflineEnv, "1")
+
+	err := ut.handler.Checkout(buildInfo(ut.upstream.dir, map[string]string{
+		refArg: "v2",
+	}))
+	if !errors.Is(err, dpl.ErrOffline) || !errors.Is(err, errCantResolveRef) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestOfflineClone(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	t.Setenv(dpl.OfflineEnv, "1")
+
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = handler.Checkout(buildInfo(upstream.dir, nil))
+	if !errors.Is(err, dpl.ErrOffline) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestOfflineCloneFromMirror(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	cacheDir := t.TempDir()
+	handler, _ := makeCachedHandler(t, cacheDir)
+	err := handler.Checkout(buildInfo(upstream.dir, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the mirror doesn't know about this one, so it shouldn't show up
+	upstream.commit("a.txt", "second")
+	t.Setenv(dpl.OfflineEnv, "1")
+	otherHandler, otherSrcDir := makeCachedHandler(t, cacheDir)
+	err = otherHandler.Checkout(buildInfo(upstream.dir, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := checkoutHead(t, otherSrcDir); head != first {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", head, first)
+	}
+}
@@ -0,0 +1,213 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+// remoteHash finds what name points at in a remote listing, following
+// symbolic references (i.e., HEAD).
+func remoteHash(refs []*plumbing.Reference, name plumbing.ReferenceName) (plumbing.Hash, plumbing.ReferenceName, bool) {
+	for _, ref := range refs {
+		if ref.Name() != name {
+			continue
+		}
+		if ref.Type() == plumbing.SymbolicReference {
+			return remoteHash(refs, ref.Target())
+		}
+		return ref.Hash(), name, true
+	}
+	return plumbing.ZeroHash, "", false
+}
+
+// peeledRemoteHash is remoteHash, but finds the commit an annotated tag
+// points at when the remote listed it.
+func peeledRemoteHash(refs []*plumbing.Reference, name plumbing.ReferenceName) plumbing.Hash {
+	if hash, _, found := remoteHash(refs, name+"^{}"); found {
+		return hash
+	}
+	hash, _, _ := remoteHash(refs, name)
+	return hash
+}
+
+// countBehind counts the commits between current and latest, if both are
+// available locally.  Finding out otherwise would mean fetching.
+func countBehind(r *gogit.Repository, current plumbing.Hash, latest plumbing.Hash) *int {
+	if r == nil || current.IsZero() || latest.IsZero() {
+		return nil
+	}
+	var err error
+	current, err = peelHash(r, current)
+	if err != nil {
+		return nil
+	}
+	latest, err = peelHash(r, latest)
+	if err != nil {
+		return nil
+	}
+	_, err = r.CommitObject(current)
+	if err != nil {
+		return nil
+	}
+	commits, err := commitsBetween(r, current, latest)
+	if err != nil {
+		return nil
+	}
+	behind := len(commits)
+	return &behind
+}
+
+// newerTag finds the newest tag at or above current, which has to be a
+// version once prefix is removed.
+func newerTag(refs []*plumbing.Reference, current plumbing.ReferenceName, prefix string) (plumbing.ReferenceName, error) {
+	raw := strings.TrimPrefix(current.Short(), prefix)
+	// as strict as newestTag, so both agree on what counts as a version
+	version, err := semver.StrictNewVersion(raw)
+	if err != nil {
+		return "", fmt.Errorf("can't compare %v with other tags (%w)", current.Short(), err)
+	}
+	tag, err := newestTag(refs, fmt.Sprintf(">=%v", version), prefix)
+	if _, ok := err.(*noMatchingTagError); ok {
+		return current, nil
+	}
+	return tag, err
+}
+
+func tagUpstream(r *gogit.Repository, refs []*plumbing.Reference, current plumbing.ReferenceName, latest plumbing.ReferenceName) *scm.UpstreamStatus {
+	status := &scm.UpstreamStatus{
+		Current:  current.Short(),
+		Latest:   latest.Short(),
+		Outdated: current != latest,
+	}
+	currentHash, _, _ := remoteHash(refs, current)
+	latestHash, _, _ := remoteHash(refs, latest)
+	status.Behind = countBehind(r, currentHash, latestHash)
+	return status
+}
+
+// revisionUpstream compares a semver ref's newest tag with the locked
+// revision or, failing that, what's checked out.  It's only used when no
+// checkout has recorded which tag the ref resolved to.
+func revisionUpstream(r *gogit.Repository, refs []*plumbing.Reference, info scm.ScmInfo, latest plumbing.ReferenceName) *scm.UpstreamStatus {
+	status := &scm.UpstreamStatus{
+		Latest: latest.Short(),
+	}
+	current := plumbing.ZeroHash
+	if len(info.Options.Revision) > 0 {
+		current = plumbing.NewHash(info.Options.Revision)
+	} else if r != nil {
+		head, err := r.Head()
+		if err == nil {
+			current = head.Hash()
+		}
+	}
+	if current.IsZero() {
+		return status
+	}
+	latestHash := peeledRemoteHash(refs, latest)
+	status.Current = current.String()
+	status.Outdated = current != latestHash
+	status.Behind = countBehind(r, current, latestHash)
+	return status
+}
+
+// branchUpstream compares a branch with the locked revision or, failing
+// that, what's checked out.
+func branchUpstream(r *gogit.Repository, info scm.ScmInfo, latest plumbing.Hash, branch plumbing.ReferenceName) *scm.UpstreamStatus {
+	status := &scm.UpstreamStatus{
+		Latest: latest.String(),
+	}
+	current := plumbing.ZeroHash
+	if len(info.Options.Revision) > 0 {
+		current = plumbing.NewHash(info.Options.Revision)
+	} else if r != nil {
+		local, err := r.Reference(branch, true)
+		if err != nil {
+			local, err = r.Head()
+		}
+		if err == nil {
+			current = local.Hash()
+		}
+	}
+	if current.IsZero() {
+		// nothing to compare against; it's a fresh checkout either way
+		return status
+	}
+	status.Current = current.String()
+	status.Outdated = current != latest
+	status.Behind = countBehind(r, current, latest)
+	return status
+}
+
+// Upstream checks the remote's refs without fetching.  Tags are compared by
+// version, so a ref naming a tag is outdated when there's a newer release;
+// a branch is outdated when it's moved past what's checked out or locked.
+func (gh *gitHandler) Upstream(info scm.ScmInfo) (*scm.UpstreamStatus, error) {
+	settings, err := getCloneSettings(context.Background(), info)
+	if err != nil {
+		return nil, err
+	}
+	settings.backend, err = getBackend(gh.component)
+	if err != nil {
+		return nil, err
+	}
+	settings.auth, err = getAuth(gh.component, settings.url)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := listRemoteRefs(settings)
+	if err != nil {
+		return nil, err
+	}
+	repoDir, err := repositoryDir(gh.component, info)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openRepository(repoDir)
+	if err == gogit.ErrRepositoryNotExists {
+		r = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	prefix := info.Arguments[tagPrefixArg]
+	if constraint, isSemver := semverConstraint(info); isSemver {
+		latest, err := newestTag(refs, constraint, prefix)
+		if err != nil {
+			return nil, err
+		}
+		resolved := getResolvedRef(gh.component, info)
+		if len(resolved) == 0 {
+			return revisionUpstream(r, refs, info, latest), nil
+		}
+		return tagUpstream(r, refs, plumbing.NewTagReferenceName(resolved), latest), nil
+	}
+
+	target := plumbing.HEAD
+	if ref, found := info.Arguments[refArg]; found {
+		target = findRemoteRef(refs, ref)
+	}
+	if target.IsTag() {
+		latest, err := newerTag(refs, target, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return tagUpstream(r, refs, target, latest), nil
+	}
+	latest, branch, found := remoteHash(refs, target)
+	if !found {
+		// a commit or something only a refspec can reach; it can't move
+		return &scm.UpstreamStatus{
+			Current: info.Arguments[refArg],
+			Latest:  info.Arguments[refArg],
+		}, nil
+	}
+	return branchUpstream(r, info, latest, branch), nil
+}
@@ -0,0 +1,205 @@
+package git
+
+import (
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func (ut *updateTest) upstreamStatus(info scm.ScmInfo) *scm.UpstreamStatus {
+	status, err := ut.handler.(scm.UpstreamScmHandler).Upstream(info)
+	if err != nil {
+		ut.t.Fatalf("Unexpected error: %v", err)
+	}
+	return status
+}
+
+func mainInfo(ut *updateTest) scm.ScmInfo {
+	return buildInfo(ut.upstream.dir, map[string]string{
+		refArg: "main",
+	})
+}
+
+func TestUpstreamUpToDate(t *testing.T) {
+	ut := makeUpdateTest(t)
+	status := ut.upstreamStatus(mainInfo(ut))
+	if status.Outdated || status.Behind == nil || *status.Behind != 0 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestUpstreamBranchMoved(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.upstream.commit("b.txt", "second")
+	latest := ut.upstream.commit("c.txt", "third")
+
+	status := ut.upstreamStatus(mainInfo(ut))
+	if !status.Outdated || status.Latest != latest.String() || status.Behind != nil {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+
+	// once the commits are fetched, they can be counted
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFetch})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status = ut.upstreamStatus(mainInfo(ut))
+	if !status.Outdated || status.Behind == nil || *status.Behind != 2 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestUpstreamDefaultBranch(t *testing.T) {
+	ut := makeUpdateTest(t)
+	latest := ut.upstream.commit("b.txt", "second")
+	status := ut.upstreamStatus(buildInfo(ut.upstream.dir, nil))
+	if !status.Outdated || status.Latest != latest.String() {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestUpstreamLocked(t *testing.T) {
+	ut := makeUpdateTest(t)
+	locked := checkoutHead(t, ut.srcDir)
+	ut.upstream.commit("b.txt", "second")
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info := mainInfo(ut)
+	if ut.upstreamStatus(info).Outdated {
+		t.Fatalf("Checkout should be up to date")
+	}
+	info.Options.Revision = locked.String()
+	status := ut.upstreamStatus(info)
+	if !status.Outdated || status.Current != locked.String() || status.Behind == nil || *status.Behind != 1 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestUpstreamTag(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.tag("v1.0.0", upstream.commit("a.txt", "first"))
+	upstream.tag("v1.1.0", upstream.commit("a.txt", "second"))
+	upstream.tag("v2.0.0-rc1", upstream.commit("a.txt", "third"))
+
+	info := buildInfo(upstream.dir, map[string]string{
+		refArg:       "v1.0.0",
+		tagPrefixArg: "v",
+	})
+	srcDir, err := runCheckout(t, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := handler.(scm.UpstreamScmHandler).Upstream(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.Outdated || status.Current != "v1.0.0" || status.Latest != "v1.1.0" || status.Behind == nil || *status.Behind != 1 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestUpstreamSemver(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.tag("v1.0.0", upstream.commit("a.txt", "first"))
+	upstream.tag("v1.1.0", upstream.commit("a.txt", "second"))
+	upstream.tag("v2.0.0", upstream.commit("a.txt", "third"))
+
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+		Data: map[string][]string{
+			resolvedRefKey: {"v1.0.0 ."},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := handler.(scm.UpstreamScmHandler).Upstream(buildInfo(upstream.dir, map[string]string{
+		refArg:       "semver:^1",
+		tagPrefixArg: "v",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.Outdated || status.Current != "v1.0.0" || status.Latest != "v1.1.0" || status.Behind != nil {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestUpstreamSemverLocked(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.tag("v1.0.0", first)
+	second := upstream.commit("a.txt", "second")
+	upstream.tag("v1.1.0", second)
+
+	// nothing's checked out, so the lock is all there is to go on
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := buildInfo(upstream.dir, map[string]string{
+		refArg:       "semver:^1",
+		tagPrefixArg: "v",
+	})
+	info.Options.Revision = first.String()
+	status, err := handler.(scm.UpstreamScmHandler).Upstream(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.Outdated || status.Current != first.String() || status.Latest != "v1.1.0" {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+
+	info.Options.Revision = second.String()
+	status, err = handler.(scm.UpstreamScmHandler).Upstream(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Outdated || status.Current != second.String() {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestNewerTagStrict(t *testing.T) {
+	_, err := newerTag(makeTagRefs("v1.0", "v1.1.0"), plumbing.NewTagReferenceName("v1.0"), "v")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
+
+func TestUpstreamCommit(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.commit("a.txt", "second")
+
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := handler.(scm.UpstreamScmHandler).Upstream(buildInfo(upstream.dir, map[string]string{
+		refArg: first.String(),
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Outdated {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
@@ -0,0 +1,332 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+const (
+	savedCommitNamespace string = "refs/dpl/saved"
+
+	// enough to explain the problem without burying the user
+	maxReportedCommits int = 10
+)
+
+// localChanges is everything a checkout would destroy.
+type localChanges struct {
+	modified  []string
+	untracked []string
+	commits   []*object.Commit
+}
+
+func (lc *localChanges) empty() bool {
+	return len(lc.modified) == 0 && len(lc.untracked) == 0 && len(lc.commits) == 0
+}
+
+type localChangesError struct {
+	dir     string
+	changes *localChanges
+}
+
+func (lce *localChangesError) Error() string {
+	lines := []string{
+		fmt.Sprintf("checkout of %v would lose local work (use --force to discard it or --stash to keep it)", lce.dir),
+	}
+	for _, filename := range lce.changes.modified {
+		lines = append(lines, fmt.Sprintf("  modified:  %v", filename))
+	}
+	for _, filename := range lce.changes.untracked {
+		lines = append(lines, fmt.Sprintf("  untracked: %v", filename))
+	}
+	for i, commit := range lce.changes.commits {
+		if i == maxReportedCommits {
+			lines = append(lines, fmt.Sprintf("  ... and %v more commits", len(lce.changes.commits)-i))
+			break
+		}
+		summary, _, _ := strings.Cut(commit.Message, "\n")
+		lines = append(lines, fmt.Sprintf("  commit:    %v %v", commit.Hash.String()[:12], summary))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func inSparseDirs(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func treeFiles(tree *object.Tree, sparse []string) (map[string]object.TreeEntry, error) {
+	files := map[string]object.TreeEntry{}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		if len(sparse) > 0 && !inSparseDirs(name, sparse) {
+			continue
+		}
+		files[name] = entry
+	}
+}
+
+// modifiedFiles finds tracked files with staged or unstaged changes.
+// Skip-worktree entries outside a sparse checkout don't show up in go-git's
+// status, so their absence isn't a change.
+func modifiedFiles(r *gogit.Repository) ([]string, error) {
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	modified := []string{}
+	for filename, fileStatus := range status {
+		if fileStatus.Worktree == gogit.Untracked {
+			continue
+		}
+		if fileStatus.Worktree != gogit.Unmodified || fileStatus.Staging != gogit.Unmodified {
+			modified = append(modified, filename)
+		}
+	}
+	return modified, nil
+}
+
+// overwrittenFiles finds files on disk that git doesn't know about but the
+// target commit would replace.
+func overwrittenFiles(root string, idx *index.Index, target map[string]object.TreeEntry) []string {
+	tracked := map[string]bool{}
+	for _, entry := range idx.Entries {
+		if !entry.SkipWorktree {
+			tracked[entry.Name] = true
+		}
+	}
+	untracked := []string{}
+	for name := range target {
+		if tracked[name] {
+			continue
+		}
+		if _, err := os.Lstat(path.Join(root, name)); err == nil {
+			untracked = append(untracked, name)
+		}
+	}
+	return untracked
+}
+
+// reachableFromRefs checks whether some branch, tag, or remote ref other than
+// moving still points at (a descendant of) commit.
+func reachableFromRefs(r *gogit.Repository, commit *object.Commit, moving plumbing.ReferenceName) (bool, error) {
+	refs, err := r.References()
+	if err != nil {
+		return false, err
+	}
+	defer refs.Close()
+	reachable := false
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if reachable || ref.Type() != plumbing.HashReference || ref.Name() == plumbing.HEAD || ref.Name() == moving {
+			return nil
+		}
+		hash, err := peelHash(r, ref.Hash())
+		if err != nil {
+			return nil
+		}
+		tip, err := r.CommitObject(hash)
+		if err != nil {
+			// refs to trees or blobs, or commits outside a shallow clone
+			return nil
+		}
+		reachable, err = commit.IsAncestor(tip)
+		if err != nil {
+			reachable = false
+		}
+		return nil
+	})
+	return reachable, err
+}
+
+// orphanedCommits lists the commits that would become unreachable by moving
+// the moving ref from its current commit to target.
+func orphanedCommits(r *gogit.Repository, moving plumbing.ReferenceName, from plumbing.Hash, target *object.Commit) ([]*object.Commit, error) {
+	if from == target.Hash {
+		return nil, nil
+	}
+	fromCommit, err := r.CommitObject(from)
+	if err != nil {
+		return nil, err
+	}
+	reachable, err := reachableFromRefs(r, fromCommit, moving)
+	if err != nil || reachable {
+		return nil, err
+	}
+	bases, err := fromCommit.MergeBase(target)
+	if err != nil {
+		return nil, err
+	}
+	ignore := []plumbing.Hash{}
+	for _, base := range bases {
+		ignore = append(ignore, base.Hash)
+	}
+	commits := []*object.Commit{}
+	iter := object.NewCommitPreorderIter(fromCommit, nil, ignore)
+	err = iter.ForEach(func(commit *object.Commit) error {
+		commits = append(commits, commit)
+		return nil
+	})
+	if err == plumbing.ErrObjectNotFound {
+		// the edge of a shallow clone; what we found so far is enough
+		err = nil
+	}
+	return commits, err
+}
+
+// findLocalChanges works out what checking out target (and applying update)
+// would destroy.  A freshly cloned repository has an empty index and nothing
+// to lose.
+func findLocalChanges(r *gogit.Repository, target *object.Commit, update *branchUpdate, sparse []string) (*localChanges, error) {
+	changes := &localChanges{}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	if len(idx.Entries) == 0 {
+		return changes, nil
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	targetTree, err := target.Tree()
+	if err != nil {
+		return nil, err
+	}
+	targetFiles, err := treeFiles(targetTree, sparse)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes.modified, err = modifiedFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	changes.untracked = overwrittenFiles(wt.Filesystem.Root(), idx, targetFiles)
+	// commits on a branch are safe where they are, unless the branch itself
+	// is being moved
+	if head.Name() == plumbing.HEAD {
+		changes.commits, err = orphanedCommits(r, plumbing.HEAD, head.Hash(), target)
+	} else if update != nil {
+		changes.commits, err = orphanedCommits(r, update.branch, update.old, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(changes.modified)
+	sort.Strings(changes.untracked)
+	return changes, nil
+}
+
+// stashChanges hands local changes to git stash, which go-git can't do
+// itself.  Orphaned commits are kept alive with a ref under refs/dpl/saved.
+func stashChanges(r *gogit.Repository, root string, changes *localChanges) error {
+	if len(changes.modified) > 0 || len(changes.untracked) > 0 {
+		message := fmt.Sprintf("dpl checkout %v", time.Now().Format(time.RFC3339))
+		cmd := exec.Command("git", "stash", "push", "--include-untracked", "--message", message)
+		cmd.Dir = root
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git stash failed: %w (%v)", err, strings.TrimSpace(string(output)))
+		}
+		log.Printf("Stashed local changes in %v (%v)", root, message)
+	}
+	if len(changes.commits) > 0 {
+		tip := changes.commits[0].Hash
+		name := plumbing.ReferenceName(path.Join(savedCommitNamespace, tip.String()))
+		err := r.Storer.SetReference(plumbing.NewHashReference(name, tip))
+		if err != nil {
+			return err
+		}
+		log.Printf("Saved %v local commits in %v as %v", len(changes.commits), root, name)
+	}
+	return nil
+}
+
+func checkoutCommit(r *gogit.Repository, options *gogit.CheckoutOptions) (*object.Commit, error) {
+	hash := options.Hash
+	if options.Branch != "" {
+		ref, err := r.Reference(options.Branch, true)
+		if err != nil {
+			return nil, err
+		}
+		hash = ref.Hash()
+	}
+	return r.CommitObject(hash)
+}
+
+// protectLocalChanges makes sure a checkout won't silently destroy work.
+// Depending on the options, local changes are discarded, stashed, or cause
+// the checkout to be refused.
+func protectLocalChanges(r *gogit.Repository, options *gogit.CheckoutOptions, update *branchUpdate, info scm.ScmInfo, settings cloneSettings) error {
+	if info.Options.Force {
+		options.Force = true
+		return nil
+	}
+	target, err := checkoutCommit(r, options)
+	if err != nil {
+		return err
+	}
+	if update != nil {
+		target, err = r.CommitObject(update.new)
+		if err != nil {
+			return err
+		}
+	}
+	changes, err := findLocalChanges(r, target, update, settings.sparse)
+	if err != nil {
+		return err
+	}
+	if changes.empty() {
+		return nil
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	root := wt.Filesystem.Root()
+	if info.Options.Stash {
+		return stashChanges(r, root, changes)
+	}
+	return &localChangesError{
+		dir:     root,
+		changes: changes,
+	}
+}
@@ -0,0 +1,173 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+// checkoutTwice checks out first, lets the test make a mess, then tries to
+// switch to second.
+func checkoutTwice(t *testing.T, upstream *upstreamRepo, first plumbing.Hash, second plumbing.Hash,
+	options scm.CheckoutOptions, mess func(string)) (string, error) {
+	srcDir := path.Join(t.TempDir(), "src")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		refArg: first.String(),
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mess(srcDir)
+	info := buildInfo(upstream.dir, map[string]string{
+		refArg: second.String(),
+	})
+	info.Options = options
+	return srcDir, handler.Checkout(info)
+}
+
+func writeFile(t *testing.T, filename string, contents string) {
+	err := os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func expectLocalChanges(t *testing.T, err error) *localChanges {
+	lce, ok := err.(*localChangesError)
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return lce.changes
+}
+
+func TestCheckoutRefusesModified(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+
+	srcDir, err := checkoutTwice(t, upstream, first, second, scm.CheckoutOptions{}, func(srcDir string) {
+		writeFile(t, path.Join(srcDir, "a.txt"), "local")
+	})
+	changes := expectLocalChanges(t, err)
+	if len(changes.modified) != 1 || changes.modified[0] != "a.txt" {
+		t.Fatalf("Unexpected modified files: %v", changes.modified)
+	}
+	if contents := readFile(t, path.Join(srcDir, "a.txt")); contents != "local" {
+		t.Fatalf("Local change lost (%v)", contents)
+	}
+}
+
+func TestCheckoutRefusesUntracked(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("b.txt", "second")
+
+	_, err := checkoutTwice(t, upstream, first, second, scm.CheckoutOptions{}, func(srcDir string) {
+		writeFile(t, path.Join(srcDir, "b.txt"), "local")
+	})
+	changes := expectLocalChanges(t, err)
+	if len(changes.untracked) != 1 || changes.untracked[0] != "b.txt" {
+		t.Fatalf("Unexpected untracked files: %v", changes.untracked)
+	}
+}
+
+func TestCheckoutRefusesOrphanedCommits(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+
+	_, err := checkoutTwice(t, upstream, first, second, scm.CheckoutOptions{}, func(srcDir string) {
+		writeFile(t, path.Join(srcDir, "local.txt"), "local")
+		wt, err := openRepo(t, srcDir).Worktree()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = wt.Add("local.txt")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = wt.Commit("local", &gogit.CommitOptions{
+			Author: &testSignature,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+	changes := expectLocalChanges(t, err)
+	if len(changes.commits) != 1 {
+		t.Fatalf("Unexpected commits: %v", changes.commits)
+	}
+}
+
+func TestCheckoutForce(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+
+	srcDir, err := checkoutTwice(t, upstream, first, second, scm.CheckoutOptions{Force: true}, func(srcDir string) {
+		writeFile(t, path.Join(srcDir, "a.txt"), "local")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if contents := readFile(t, path.Join(srcDir, "a.txt")); contents != "second" {
+		t.Fatalf("Unexpected contents (%v)", contents)
+	}
+}
+
+func TestCheckoutStash(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	second := upstream.commit("a.txt", "second")
+
+	srcDir, err := checkoutTwice(t, upstream, first, second, scm.CheckoutOptions{Stash: true}, func(srcDir string) {
+		writeFile(t, path.Join(srcDir, "a.txt"), "local")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := checkoutHead(t, srcDir); actual != second {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", actual, second)
+	}
+	cmd := exec.Command("git", "stash", "list")
+	cmd.Dir = srcDir
+	output, err := cmd.CombinedOutput()
+	if err != nil || len(output) == 0 {
+		t.Fatalf("Expected a stash: %v (%v)", err, string(output))
+	}
+}
+
+func TestCheckoutSameRefKeepsChanges(t *testing.T) {
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+
+	for _, options := range []scm.CheckoutOptions{{}, {Stash: true}} {
+		srcDir, err := checkoutTwice(t, upstream, first, first, options, func(srcDir string) {
+			writeFile(t, path.Join(srcDir, "a.txt"), "local")
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if contents := readFile(t, path.Join(srcDir, "a.txt")); contents != "local" {
+			t.Fatalf("Local change lost (%v)", contents)
+		}
+		r := openRepo(t, srcDir)
+		_, err = r.Reference(plumbing.ReferenceName("refs/stash"), false)
+		if err != plumbing.ErrReferenceNotFound {
+			t.Fatalf("Unexpected stash: %v", err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+const (
+	// ref=semver:^2.3 picks the newest tag matching the constraint
+	semverRefPrefix string = "semver:"
+
+	// each value is "<tag> <path>", so every semver uri checked out into
+	// its own directory keeps its own tag
+	resolvedRefKey string = "dpl.scm.resolved_ref"
+)
+
+type noMatchingTagError struct {
+	constraint string
+}
+
+func (nmte *noMatchingTagError) Error() string {
+	return fmt.Sprintf("no tags match '%v'", nmte.constraint)
+}
+
+// resolvedRefPath is what a resolved tag is recorded against: the directory
+// info checks out into, relative to the component's source directory.
+func resolvedRefPath(info scm.ScmInfo) string {
+	offset, found := info.Arguments[pathArg]
+	if !found {
+		return "."
+	}
+	return path.Clean(offset)
+}
+
+// getResolvedRef finds the tag info's semver ref resolved to the last time
+// it was checked out.
+func getResolvedRef(component dpl.Component, info scm.ScmInfo) string {
+	offset := resolvedRefPath(info)
+	for _, value := range component.GetValues(resolvedRefKey) {
+		tag, dir, found := strings.Cut(value, " ")
+		if found && dir == offset {
+			return tag
+		}
+	}
+	return ""
+}
+
+// setResolvedRef records the tag info's semver ref resolved to, replacing
+// whatever was there for the same directory.
+func setResolvedRef(component dpl.Component, info scm.ScmInfo, tag string) {
+	offset := resolvedRefPath(info)
+	values := []string{}
+	for _, value := range component.GetValues(resolvedRefKey) {
+		if _, dir, found := strings.Cut(value, " "); found && dir != offset {
+			values = append(values, value)
+		}
+	}
+	component.SetValues(resolvedRefKey, append(values, fmt.Sprintf("%v %v", tag, offset)))
+}
+
+func semverConstraint(info scm.ScmInfo) (string, bool) {
+	return strings.CutPrefix(info.Arguments[refArg], semverRefPrefix)
+}
+
+// newestTag finds the highest version among refs that satisfies constraint.
+// Tags have to be strict semantic versions once prefix is removed; anything
+// else is ignored.
+func newestTag(refs []*plumbing.Reference, constraint string, prefix string) (plumbing.ReferenceName, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", &invalidArgumentError{
+			arg:   refArg,
+			value: semverRefPrefix + constraint,
+		}
+	}
+	var best *semver.Version
+	var bestName plumbing.ReferenceName
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		raw, found := strings.CutPrefix(ref.Name().Short(), prefix)
+		if !found {
+			continue
+		}
+		version, err := semver.StrictNewVersion(raw)
+		if err != nil || !c.Check(version) {
+			continue
+		}
+		if best == nil || version.GreaterThan(best) {
+			best = version
+			bestName = ref.Name()
+		}
+	}
+	if best == nil {
+		return "", &noMatchingTagError{
+			constraint: constraint,
+		}
+	}
+	return bestName, nil
+}
+
+// pinSemverRef replaces a semver ref with the tag it selects from refs.  The
+// tag is returned so it can be recorded; it's empty if the ref wasn't a
+// semver constraint.
+func pinSemverRef(info scm.ScmInfo, refs []*plumbing.Reference) (scm.ScmInfo, string, error) {
+	constraint, found := semverConstraint(info)
+	if !found {
+		return info, "", nil
+	}
+	tag, err := newestTag(refs, constraint, info.Arguments[tagPrefixArg])
+	if err != nil {
+		return info, "", err
+	}
+	arguments := map[string]string{}
+	for k, v := range info.Arguments {
+		arguments[k] = v
+	}
+	arguments[refArg] = string(tag)
+	info.Arguments = arguments
+	return info, tag.Short(), nil
+}
+
+// resolveSemverRef picks a tag from what the remote has.  Offline, the tags
+// already in repoDir are used instead.
+func resolveSemverRef(info scm.ScmInfo, settings cloneSettings, repoDir string) (scm.ScmInfo, string, error) {
+	if _, found := semverConstraint(info); !found {
+		return info, "", nil
+	}
+	refs, err := listRemoteRefs(settings)
+	if errors.Is(err, dpl.ErrOffline) {
+		r, openErr := openRepository(repoDir)
+		if openErr == nil {
+			refs, err = localRefs(r)
+		}
+	}
+	if err != nil {
+		return info, "", err
+	}
+	return pinSemverRef(info, refs)
+}
+
+// localRefs lists the references in an existing repository, for resolving
+// semver refs without going to the network.
+func localRefs(r *gogit.Repository) ([]*plumbing.Reference, error) {
+	iter, err := r.References()
+	if err != nil {
+		return nil, err
+	}
+	refs := []*plumbing.Reference{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	return refs, err
+}
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func makeTagRefs(names ...string) []*plumbing.Reference {
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("v9.0.0"), plumbing.ZeroHash),
+	}
+	for _, name := range names {
+		refs = append(refs, plumbing.NewHashReference(plumbing.NewTagReferenceName(name), plumbing.ZeroHash))
+	}
+	return refs
+}
+
+func TestNewestTag(t *testing.T) {
+	refs := makeTagRefs("v1.4.0", "v1.4.7", "v1.5.0", "v2.3.0", "v2.9.1", "v3.0.0-rc1", "v3.0.0", "2.99.0", "v2.10.0-beta", "junk")
+	cases := map[string]string{
+		"^2.3":      "v2.9.1",
+		"~1.4":      "v1.4.7",
+		">=1.0 <2":  "v1.5.0",
+		"*":         "v3.0.0",
+		">=3.0.0-0": "v3.0.0",
+	}
+	for constraint, expected := range cases {
+		tag, err := newestTag(refs, constraint, "v")
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", constraint, err)
+		}
+		if tag.Short() != expected {
+			t.Fatalf("Unexpected tag for %v (%v vs %v)", constraint, tag.Short(), expected)
+		}
+	}
+}
+
+func TestNewestTagNoPrefix(t *testing.T) {
+	tag, err := newestTag(makeTagRefs("v2.9.1", "2.4.0"), "^2", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tag.Short() != "2.4.0" {
+		t.Fatalf("Unexpected tag: %v", tag)
+	}
+}
+
+func TestNewestTagNoMatch(t *testing.T) {
+	_, err := newestTag(makeTagRefs("v1.0.0"), "^2", "v")
+	var noMatch *noMatchingTagError
+	if !errors.As(err, &noMatch) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestNewestTagBadConstraint(t *testing.T) {
+	_, err := newestTag(makeTagRefs("v1.0.0"), "not a version", "v")
+	var badArg *invalidArgumentError
+	if !errors.As(err, &badArg) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckoutSemver(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.tag("v2.3.0", upstream.commit("a.txt", "first"))
+	expected := upstream.commit("a.txt", "second")
+	upstream.tag("v2.4.1", expected)
+	upstream.tag("v3.0.0", upstream.commit("a.txt", "third"))
+
+	component := &testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+	}
+	handler, err := makeGit(component)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := buildInfo(upstream.dir, map[string]string{
+		refArg:       "semver:^2.3",
+		tagPrefixArg: "v",
+	})
+	err = handler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	actual := checkoutHead(t, component.SourceDir)
+	if actual != expected {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", actual, expected)
+	}
+	if !reflect.DeepEqual(component.GetValues(resolvedRefKey), []string{"v2.4.1 ."}) {
+		t.Fatalf("Unexpected resolved ref: %v", component.GetValues(resolvedRefKey))
+	}
+	if info.Arguments[refArg] != "semver:^2.3" {
+		t.Fatalf("Arguments were modified: %v", info.Arguments)
+	}
+	status, err := handler.(scm.StatusScmHandler).Status(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.MatchesRef {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestResolvedRefPerPath(t *testing.T) {
+	component := &testcommon.ResolveComponent{}
+	lib := buildInfo("lib", map[string]string{pathArg: "lib"})
+	app := buildInfo("app", nil)
+	setResolvedRef(component, lib, "v1.0.0")
+	setResolvedRef(component, app, "v2.0.0")
+	setResolvedRef(component, lib, "v1.1.0")
+
+	if actual := getResolvedRef(component, lib); actual != "v1.1.0" {
+		t.Fatalf("Unexpected resolved ref for lib: %v", actual)
+	}
+	if actual := getResolvedRef(component, app); actual != "v2.0.0" {
+		t.Fatalf("Unexpected resolved ref for app: %v", actual)
+	}
+}
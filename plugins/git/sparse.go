@@ -0,0 +1,85 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+const (
+	repoDirKey string = "scm.git.repo_dir"
+	// configure points every component at the directory holding build.config
+	configDirKey string = "dpl.config_dir"
+)
+
+func getSparseDirs(info scm.ScmInfo) ([]string, error) {
+	raw, found := info.Arguments[sparseArg]
+	if !found {
+		return nil, nil
+	}
+	dirs := []string{}
+	for _, dir := range strings.Split(raw, ",") {
+		dir = strings.TrimSpace(dir)
+		if !scm.ContainedPath(dir) || path.Clean(dir) == "." {
+			return nil, &invalidArgumentError{
+				arg:   sparseArg,
+				value: raw,
+			}
+		}
+		dirs = append(dirs, path.Clean(dir))
+	}
+	return dirs, nil
+}
+
+type repoDirError struct {
+	repoDir string
+	reason  string
+}
+
+func (rde *repoDirError) Error() string {
+	return fmt.Sprintf("can't use %v as a repository (%v)", rde.repoDir, rde.reason)
+}
+
+// repositoryDir finds where the repository lives.  That's the source
+// directory unless scm.git.repo_dir says otherwise; a component using a
+// sparse checkout can set it (e.g., to ..) so its source directory is one of
+// the sparse directories.  Nothing holding build.config is ever used, since
+// by default that's also where every other component lives.
+func repositoryDir(component dpl.Component, info scm.ScmInfo) (string, error) {
+	srcDir := component.GetSourceDir()
+	if offset, found := info.Arguments[pathArg]; found {
+		srcDir = path.Join(srcDir, offset)
+	}
+	srcDir = path.Clean(srcDir)
+	repoDir, err := dpl.GetSingleComponentValueOrDefault(component, repoDirKey, "")
+	if err != nil {
+		return "", err
+	}
+	if len(repoDir) == 0 {
+		repoDir = srcDir
+	} else if !path.IsAbs(repoDir) {
+		repoDir = path.Join(srcDir, repoDir)
+	}
+	repoDir = path.Clean(repoDir)
+	if repoDir != srcDir && !strings.HasPrefix(srcDir, repoDir+"/") {
+		return "", &repoDirError{
+			repoDir: repoDir,
+			reason:  fmt.Sprintf("%v isn't inside it", srcDir),
+		}
+	}
+	configDir, err := dpl.GetSingleComponentValueOrDefault(component, configDirKey, "")
+	if err != nil {
+		return "", err
+	}
+	configDir = path.Clean(configDir)
+	if len(configDir) > 0 && (configDir == repoDir || strings.HasPrefix(configDir, repoDir+"/")) {
+		return "", &repoDirError{
+			repoDir: repoDir,
+			reason:  "it holds the project's build.config",
+		}
+	}
+	return repoDir, nil
+}
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func makeMonorepo(t *testing.T) *upstreamRepo {
+	upstream := makeUpstream(t)
+	upstream.commit("README", "top")
+	upstream.commit("libs/foo/foo.c", "foo")
+	upstream.commit("libs/bar/bar.c", "bar")
+	return upstream
+}
+
+func expectFiles(t *testing.T, root string, present []string, missing []string) {
+	for _, name := range present {
+		if _, err := os.Stat(path.Join(root, name)); err != nil {
+			t.Errorf("Expected %v: %v", name, err)
+		}
+	}
+	for _, name := range missing {
+		if _, err := os.Stat(path.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("Unexpected %v (%v)", name, err)
+		}
+	}
+}
+
+// expectClean asks git itself, since it understands skip-worktree entries
+func expectClean(t *testing.T, root string) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = root
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (%v)", err, string(output))
+	}
+	if len(output) > 0 {
+		t.Fatalf("Unexpected status:\n%v", string(output))
+	}
+}
+
+func TestSparseCheckout(t *testing.T) {
+	upstream := makeMonorepo(t)
+
+	srcDir, err := runCheckout(t, buildInfo(upstream.dir, map[string]string{
+		sparseArg: "libs/foo",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectFiles(t, srcDir, []string{"libs/foo/foo.c"}, []string{"README", "libs/bar"})
+	expectClean(t, srcDir)
+}
+
+func TestSparseSourceDir(t *testing.T) {
+	upstream := makeMonorepo(t)
+	root := path.Join(t.TempDir(), "monorepo")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(root, "libs", "foo"),
+		Data: map[string][]string{
+			repoDirKey: {"../.."},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		sparseArg: "libs/foo",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectFiles(t, root, []string{".git", "libs/foo/foo.c"}, []string{"README", "libs/bar"})
+}
+
+func TestSparseSourceDirNamedLikeSparseDir(t *testing.T) {
+	// a source dir that happens to end in a sparse dir is still the
+	// repository unless scm.git.repo_dir says otherwise
+	upstream := makeMonorepo(t)
+	root := t.TempDir()
+	srcDir := path.Join(root, "foo")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+		Data: map[string][]string{
+			configDirKey: {root},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		sparseArg: "foo",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectFiles(t, srcDir, []string{".git"}, nil)
+	expectFiles(t, root, nil, []string{".git"})
+}
+
+func TestSparseRepoDirProjectRoot(t *testing.T) {
+	upstream := makeMonorepo(t)
+	root := t.TempDir()
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(root, "foo"),
+		Data: map[string][]string{
+			repoDirKey:   {".."},
+			configDirKey: {root},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		sparseArg: "foo",
+	}))
+	if _, ok := err.(*repoDirError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectFiles(t, root, nil, []string{".git"})
+}
+
+func TestSparseRepoDirOutsideSource(t *testing.T) {
+	upstream := makeMonorepo(t)
+	root := t.TempDir()
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(root, "foo"),
+		Data: map[string][]string{
+			repoDirKey: {"../bar"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = handler.Checkout(buildInfo(upstream.dir, nil))
+	if _, ok := err.(*repoDirError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSparseUpdate(t *testing.T) {
+	upstream := makeMonorepo(t)
+	srcDir := path.Join(t.TempDir(), "src")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		sparseArg: "libs/foo,libs/bar",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// narrowing the sparse set should drop the other directory
+	second := upstream.commit("libs/foo/foo.h", "header")
+	err = handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		refArg:    second.String(),
+		sparseArg: "libs/foo",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectFiles(t, srcDir, []string{"libs/foo/foo.c", "libs/foo/foo.h"}, []string{"README", "libs/bar"})
+	expectClean(t, srcDir)
+	if actual := checkoutHead(t, srcDir); actual != second {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", actual, second)
+	}
+}
+
+func TestSparseInvalid(t *testing.T) {
+	upstream := makeMonorepo(t)
+
+	_, err := runCheckout(t, buildInfo(upstream.dir, map[string]string{
+		sparseArg: "../outside",
+	}))
+	if _, ok := err.(*invalidArgumentError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
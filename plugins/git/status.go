@@ -0,0 +1,179 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+// untrackedFiles finds files git doesn't know about.  Like modifiedFiles,
+// sparse checkouts are walked by hand, and only inside the sparse
+// directories.
+func untrackedFiles(r *gogit.Repository, idx *index.Index, sparse []string) ([]string, error) {
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	untracked := []string{}
+	if len(sparse) == 0 {
+		status, err := wt.Status()
+		if err != nil {
+			return nil, err
+		}
+		for filename, fileStatus := range status {
+			if fileStatus.Worktree == gogit.Untracked {
+				untracked = append(untracked, filename)
+			}
+		}
+		return untracked, nil
+	}
+
+	tracked := map[string]bool{}
+	for _, entry := range idx.Entries {
+		tracked[entry.Name] = true
+	}
+	root := wt.Filesystem.Root()
+	for _, dir := range sparse {
+		err := filepath.WalkDir(path.Join(root, dir), func(filename string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			name, err := filepath.Rel(root, filename)
+			if err != nil {
+				return err
+			}
+			if !tracked[name] {
+				untracked = append(untracked, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return untracked, nil
+}
+
+// matchesRef reports whether HEAD is where a checkout would put it.  Without
+// a configured ref, anything matches.  Semver refs are resolved against the
+// tags already fetched.
+func matchesRef(r *gogit.Repository, head *plumbing.Reference, info scm.ScmInfo) bool {
+	_, hasRef := info.Arguments[refArg]
+	_, hasRefSpec := info.Arguments[refSpecArg]
+	if !hasRef && !hasRefSpec {
+		return true
+	}
+	if _, isSemver := semverConstraint(info); isSemver {
+		refs, err := localRefs(r)
+		if err != nil {
+			return false
+		}
+		info, _, err = pinSemverRef(info, refs)
+		if err != nil {
+			return false
+		}
+	}
+	options, err := makeCheckoutOptions(r, info)
+	if err != nil {
+		return false
+	}
+	if options.Branch != "" {
+		return head.Name() == options.Branch
+	}
+	return head.Hash() == options.Hash
+}
+
+// trackingStatus counts how far a branch and its remote tracking branch have
+// drifted apart.
+func trackingStatus(r *gogit.Repository, head *plumbing.Reference, status *scm.SourceStatus) error {
+	if !head.Name().IsBranch() {
+		return nil
+	}
+	upstreamName := plumbing.NewRemoteReferenceName(gogit.DefaultRemoteName, head.Name().Short())
+	upstream, err := r.Reference(upstreamName, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	status.Upstream = upstreamName.Short()
+	ahead, err := commitsBetween(r, upstream.Hash(), head.Hash())
+	if err != nil {
+		return err
+	}
+	behind, err := commitsBetween(r, head.Hash(), upstream.Hash())
+	if err != nil {
+		return err
+	}
+	status.Ahead = len(ahead)
+	status.Behind = len(behind)
+	return nil
+}
+
+func (gh *gitHandler) Status(info scm.ScmInfo) (*scm.SourceStatus, error) {
+	settings, err := getCloneSettings(context.Background(), info)
+	if err != nil {
+		return nil, err
+	}
+	repoDir, err := repositoryDir(gh.component, info)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openRepository(repoDir)
+	if err == gogit.ErrRepositoryNotExists {
+		return &scm.SourceStatus{
+			Missing: true,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	status := &scm.SourceStatus{
+		Commit:     head.Hash().String(),
+		Ref:        info.Arguments[refArg],
+		MatchesRef: matchesRef(r, head, info),
+	}
+	if head.Name().IsBranch() {
+		status.Branch = head.Name().Short()
+	}
+	err = trackingStatus(r, head, status)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	status.Modified, err = modifiedFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	status.Untracked, err = untrackedFiles(r, idx, settings.sparse)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(status.Modified)
+	sort.Strings(status.Untracked)
+	return status, nil
+}
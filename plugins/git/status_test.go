@@ -0,0 +1,88 @@
+package git
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func (ut *updateTest) status(ref string) *scm.SourceStatus {
+	info := buildInfo(ut.upstream.dir, map[string]string{
+		refArg: ref,
+	})
+	status, err := ut.handler.(scm.StatusScmHandler).Status(info)
+	if err != nil {
+		ut.t.Fatalf("Unexpected error: %v", err)
+	}
+	return status
+}
+
+func TestStatusClean(t *testing.T) {
+	ut := makeUpdateTest(t)
+	status := ut.status("main")
+	expected := &scm.SourceStatus{
+		Branch:     "main",
+		Commit:     checkoutHead(t, ut.srcDir).String(),
+		Ref:        "main",
+		MatchesRef: true,
+		Upstream:   "origin/main",
+		Modified:   []string{},
+		Untracked:  []string{},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestStatusAheadBehind(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.commitLocally()
+	ut.upstream.commit("b.txt", "second")
+	ut.upstream.commit("c.txt", "third")
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFetch})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status := ut.status("main")
+	if status.Ahead != 1 || status.Behind != 2 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestStatusChanges(t *testing.T) {
+	ut := makeUpdateTest(t)
+	writeFile(t, path.Join(ut.srcDir, "a.txt"), "changed")
+	writeFile(t, path.Join(ut.srcDir, "new.txt"), "new")
+	status := ut.status("main")
+	if !reflect.DeepEqual(status.Modified, []string{"a.txt"}) || !reflect.DeepEqual(status.Untracked, []string{"new.txt"}) {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestStatusRefDiffers(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.upstream.tag("v1", ut.upstream.commit("b.txt", "second"))
+	status := ut.status("v1")
+	if status.MatchesRef {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
+
+func TestStatusMissing(t *testing.T) {
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := handler.(scm.StatusScmHandler).Status(buildInfo("unused", nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.Missing {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	gogit "github.com/go-git/go-git/v5"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+const (
+	submodulesNone      string = "none"
+	submodulesInit      string = "init"
+	submodulesRecursive string = "recursive"
+)
+
+func getSubmoduleMode(info scm.ScmInfo) (string, error) {
+	mode, found := info.Arguments[submodulesArg]
+	if !found {
+		return submodulesNone, nil
+	}
+	switch mode {
+	case submodulesNone, submodulesInit, submodulesRecursive:
+		return mode, nil
+	}
+	return "", &invalidArgumentError{
+		arg:   submodulesArg,
+		value: mode,
+	}
+}
+
+func submoduleURL(r *gogit.Repository) (string, error) {
+	remote, err := r.Remote(gogit.DefaultRemoteName)
+	if err != nil {
+		return "", err
+	}
+	return remote.Config().URLs[0], nil
+}
+
+// updateSubmodule fetches a single submodule (through its own mirror, if
+// caching is enabled) and checks out the commit the superproject records.
+func updateSubmodule(submodule *gogit.Submodule, settings cloneSettings) (*gogit.Repository, error) {
+	err := submodule.Init()
+	if err != nil && err != gogit.ErrSubmoduleAlreadyInitialized {
+		return nil, err
+	}
+	r, err := submodule.Repository()
+	if err != nil {
+		return nil, err
+	}
+	settings.url, err = submoduleURL(r)
+	if err != nil {
+		return nil, err
+	}
+	// the superproject's credentials are meant for its own host
+	settings.auth, err = getAuth(settings.component, settings.url)
+	if err != nil {
+		return nil, err
+	}
+	if len(settings.cacheDir) > 0 {
+		var lock *mirrorLock
+		settings.mirror, lock, err = updateMirror(settings)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Unlock()
+	}
+	// the recorded commit may not be on any branch, so fetch everything the
+	// remote has before asking go-git to check it out
+	err = fetchRefSpecs(r, cloneSettings{
+		ctx:     settings.ctx,
+		url:     settings.url,
+		auth:    settings.auth,
+		mirror:  settings.mirror,
+		tags:    gogit.TagFollowing,
+		offline: settings.offline,
+		backend: settings.backend,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r, submodule.UpdateContext(settings.ctx, &gogit.SubmoduleUpdateOptions{
+		NoFetch: true,
+	})
+}
+
+func updateSubmoduleTree(r *gogit.Repository, settings cloneSettings, recurse bool) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return err
+	}
+	for _, submodule := range submodules {
+		subRepo, err := updateSubmodule(submodule, settings)
+		if err != nil {
+			return err
+		}
+		if recurse {
+			err = updateSubmoduleTree(subRepo, settings, recurse)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateSubmodules moves every submodule to the commit recorded in the
+// superproject, initializing any that are new.
+func updateSubmodules(r *gogit.Repository, settings cloneSettings) error {
+	if settings.submodules == submodulesNone {
+		return nil
+	}
+	return settings.backend.updateSubmodules(r, settings)
+}
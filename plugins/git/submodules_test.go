@@ -0,0 +1,127 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{
+		"-c", "protocol.file.allow=always",
+		"-c", "user.name=dpl",
+		"-c", "user.email=dpl@example.com",
+	}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error running git %v: %v (%v)", args, err, string(output))
+	}
+}
+
+func makeSuperproject(t *testing.T, sub *upstreamRepo) string {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--initial-branch=main")
+	runGit(t, dir, "submodule", "add", sub.dir, "sub")
+	runGit(t, dir, "commit", "-m", "add submodule")
+	return dir
+}
+
+func readFile(t *testing.T, filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return string(data)
+}
+
+func TestSubmodulesInit(t *testing.T) {
+	sub := makeUpstream(t)
+	sub.commit("a.txt", "first")
+	super := makeSuperproject(t, sub)
+
+	srcDir := path.Join(t.TempDir(), "src")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := buildInfo(super, map[string]string{
+		submodulesArg: submodulesInit,
+	})
+	err = handler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if contents := readFile(t, path.Join(srcDir, "sub", "a.txt")); contents != "first" {
+		t.Fatalf("Unexpected submodule contents: %v", contents)
+	}
+
+	// move the submodule forward in the superproject; the next checkout should follow
+	sub.commit("a.txt", "second")
+	runGit(t, path.Join(super, "sub"), "pull", "origin", "main")
+	runGit(t, super, "commit", "-am", "bump submodule")
+	info.Arguments[refArg] = checkoutHead(t, super).String()
+	err = handler.Checkout(info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if contents := readFile(t, path.Join(srcDir, "sub", "a.txt")); contents != "second" {
+		t.Fatalf("Unexpected submodule contents: %v", contents)
+	}
+}
+
+func TestSubmodulesNone(t *testing.T) {
+	sub := makeUpstream(t)
+	sub.commit("a.txt", "first")
+	super := makeSuperproject(t, sub)
+
+	srcDir, err := runCheckout(t, buildInfo(super, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path.Join(srcDir, "sub", "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("Unexpected submodule checkout: %v", err)
+	}
+}
+
+func TestSubmodulesInvalidMode(t *testing.T) {
+	_, err := getCloneSettings(context.Background(), buildInfo("", map[string]string{
+		submodulesArg: "sometimes",
+	}))
+	if _, ok := err.(*invalidArgumentError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSubmodulesOwnAuth(t *testing.T) {
+	sub := makeUpstream(t)
+	sub.commit("a.txt", "first")
+	super := makeSuperproject(t, sub)
+	// the superproject's url needs no credentials, but the submodule's does
+	runGit(t, super, "config", "--file", ".gitmodules", "submodule.sub.url", "https://example.invalid/sub.git")
+	runGit(t, super, "commit", "-am", "move submodule")
+
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+		Data: map[string][]string{
+			tokenEnvKey: {"DPL_TEST_SUBMODULE_TOKEN"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv("DPL_TEST_SUBMODULE_TOKEN", "")
+	err = handler.Checkout(buildInfo(super, map[string]string{
+		submodulesArg: submodulesInit,
+	}))
+	if !errors.Is(err, errMissingToken) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package git
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+type divergedBranchError struct {
+	branch plumbing.ReferenceName
+}
+
+func (dbe *divergedBranchError) Error() string {
+	return fmt.Sprintf("%v has diverged from upstream and can't be fast-forwarded (use --update=reset to replace it)", dbe.branch.Short())
+}
+
+// branchUpdate is a pending move of a local branch to match upstream.
+type branchUpdate struct {
+	branch plumbing.ReferenceName
+	old    plumbing.Hash
+	new    plumbing.Hash
+}
+
+func (bu *branchUpdate) apply(r *gogit.Repository) error {
+	return r.Storer.SetReference(plumbing.NewHashReference(bu.branch, bu.new))
+}
+
+// planBranchUpdate works out where a local branch should move to under the
+// given policy.  Only branches with a remote tracking branch are updated; a
+// nil update means nothing needs to move.
+func planBranchUpdate(r *gogit.Repository, options *gogit.CheckoutOptions, policy string) (*branchUpdate, error) {
+	if options.Branch == "" || (policy != scm.UpdateFastForward && policy != scm.UpdateReset) {
+		return nil, nil
+	}
+	local, err := r.Reference(options.Branch, true)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := r.Reference(plumbing.NewRemoteReferenceName(gogit.DefaultRemoteName, options.Branch.Short()), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if local.Hash() == remote.Hash() {
+		return nil, nil
+	}
+	update := &branchUpdate{
+		branch: options.Branch,
+		old:    local.Hash(),
+		new:    remote.Hash(),
+	}
+	if policy == scm.UpdateReset {
+		return update, nil
+	}
+
+	localCommit, err := r.CommitObject(local.Hash())
+	if err != nil {
+		return nil, err
+	}
+	remoteCommit, err := r.CommitObject(remote.Hash())
+	if err != nil {
+		return nil, err
+	}
+	forward, err := localCommit.IsAncestor(remoteCommit)
+	if err != nil {
+		return nil, err
+	}
+	if forward {
+		return update, nil
+	}
+	behind, err := remoteCommit.IsAncestor(localCommit)
+	if err != nil {
+		return nil, err
+	}
+	if behind {
+		// local commits that haven't been pushed yet; nothing to pull in
+		return nil, nil
+	}
+	return nil, &divergedBranchError{
+		branch: options.Branch,
+	}
+}
+
+// commitsBetween finds the commits reachable from new but not from old,
+// newest first.  old doesn't need to exist locally.
+func commitsBetween(r *gogit.Repository, old plumbing.Hash, new plumbing.Hash) ([]*object.Commit, error) {
+	newCommit, err := r.CommitObject(new)
+	if err != nil {
+		return nil, err
+	}
+	ignore := []plumbing.Hash{old}
+	oldCommit, err := r.CommitObject(old)
+	if err == nil {
+		bases, err := oldCommit.MergeBase(newCommit)
+		if err != nil {
+			return nil, err
+		}
+		for _, base := range bases {
+			ignore = append(ignore, base.Hash)
+		}
+	}
+	commits := []*object.Commit{}
+	iter := object.NewCommitPreorderIter(newCommit, nil, ignore)
+	err = iter.ForEach(func(commit *object.Commit) error {
+		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil && err != plumbing.ErrObjectNotFound {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// reportUpdate logs the commits an update pulled in, newest first.
+func reportUpdate(r *gogit.Repository, name string, update *branchUpdate) error {
+	if update == nil {
+		return nil
+	}
+	commits, err := commitsBetween(r, update.old, update.new)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%v: updated %v %v..%v (%v commits)", name, update.branch.Short(),
+		update.old.String()[:12], update.new.String()[:12], len(commits))
+	for i, commit := range commits {
+		if i == maxReportedCommits {
+			log.Printf("%v:   ... and %v more", name, len(commits)-i)
+			break
+		}
+		summary, _, _ := strings.Cut(commit.Message, "\n")
+		log.Printf("%v:   %v %v", name, commit.Hash.String()[:12], summary)
+	}
+	return nil
+}
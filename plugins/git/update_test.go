@@ -0,0 +1,198 @@
+package git
+
+import (
+	"path"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+type updateTest struct {
+	t        *testing.T
+	upstream *upstreamRepo
+	srcDir   string
+	handler  scm.ScmHandler
+}
+
+// makeUpdateTest checks out upstream's main branch so later checkouts have
+// something to update.
+func makeUpdateTest(t *testing.T) *updateTest {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+	srcDir := path.Join(t.TempDir(), "src")
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: srcDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut := &updateTest{
+		t:        t,
+		upstream: upstream,
+		srcDir:   srcDir,
+		handler:  handler,
+	}
+	err = ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return ut
+}
+
+func (ut *updateTest) checkout(options scm.CheckoutOptions) error {
+	info := buildInfo(ut.upstream.dir, map[string]string{
+		refArg: "main",
+	})
+	info.Options = options
+	return ut.handler.Checkout(info)
+}
+
+func (ut *updateTest) commitLocally() {
+	writeFile(ut.t, path.Join(ut.srcDir, "local.txt"), "local")
+	wt, err := openRepo(ut.t, ut.srcDir).Worktree()
+	if err != nil {
+		ut.t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = wt.Add("local.txt")
+	if err != nil {
+		ut.t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = wt.Commit("local", &gogit.CommitOptions{
+		Author: &testSignature,
+	})
+	if err != nil {
+		ut.t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func (ut *updateTest) expectHead(expected plumbing.Hash) {
+	head, err := openRepo(ut.t, ut.srcDir).Head()
+	if err != nil {
+		ut.t.Fatalf("Unexpected error: %v", err)
+	}
+	if head.Name() != plumbing.NewBranchReferenceName("main") {
+		ut.t.Fatalf("Unexpected HEAD (%v)", head.Name())
+	}
+	if head.Hash() != expected {
+		ut.t.Fatalf("Unexpected HEAD (%v vs %v)", head.Hash(), expected)
+	}
+}
+
+func TestUpdateFastForward(t *testing.T) {
+	ut := makeUpdateTest(t)
+	second := ut.upstream.commit("a.txt", "second")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut.expectHead(second)
+	if contents := readFile(t, path.Join(ut.srcDir, "a.txt")); contents != "second" {
+		t.Fatalf("Unexpected contents (%v)", contents)
+	}
+}
+
+func TestUpdateFetchOnly(t *testing.T) {
+	ut := makeUpdateTest(t)
+	first := checkoutHead(t, ut.srcDir)
+	second := ut.upstream.commit("a.txt", "second")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFetch})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut.expectHead(first)
+	remote, err := openRepo(t, ut.srcDir).Reference(plumbing.NewRemoteReferenceName(gogit.DefaultRemoteName, "main"), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if remote.Hash() != second {
+		t.Fatalf("Unexpected remote branch (%v vs %v)", remote.Hash(), second)
+	}
+}
+
+func TestUpdateNever(t *testing.T) {
+	ut := makeUpdateTest(t)
+	first := checkoutHead(t, ut.srcDir)
+	ut.upstream.commit("a.txt", "second")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateNever})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut.expectHead(first)
+}
+
+func TestUpdateLocalCommitsAhead(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.commitLocally()
+	local := checkoutHead(t, ut.srcDir)
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut.expectHead(local)
+}
+
+func TestUpdateDiverged(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.commitLocally()
+	ut.upstream.commit("a.txt", "second")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward})
+	if _, ok := err.(*divergedBranchError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestUpdateResetProtectsCommits(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.commitLocally()
+	ut.upstream.commit("a.txt", "second")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateReset})
+	changes := expectLocalChanges(t, err)
+	if len(changes.commits) != 1 {
+		t.Fatalf("Unexpected commits: %v", changes.commits)
+	}
+}
+
+func TestUpdateResetForced(t *testing.T) {
+	ut := makeUpdateTest(t)
+	ut.commitLocally()
+	second := ut.upstream.commit("a.txt", "second")
+
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateReset, Force: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ut.expectHead(second)
+}
+
+func TestUpdateLockedRevision(t *testing.T) {
+	ut := makeUpdateTest(t)
+	first := checkoutHead(t, ut.srcDir)
+	second := ut.upstream.commit("a.txt", "second")
+	ut.upstream.commit("a.txt", "third")
+
+	// a locked revision wins over both the configured ref and the policy
+	err := ut.checkout(scm.CheckoutOptions{Update: scm.UpdateNever, Revision: second.String()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := checkoutHead(t, ut.srcDir); head != second {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", head, second)
+	}
+	err = ut.checkout(scm.CheckoutOptions{Update: scm.UpdateFastForward, Revision: first.String()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := checkoutHead(t, ut.srcDir); head != first {
+		t.Fatalf("Unexpected HEAD (%v vs %v)", head, first)
+	}
+}
@@ -0,0 +1,151 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/dev-pipeline/dpl-go/pkg/dpl"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+const (
+	trustedKeysKey string = "scm.git.trusted_keys"
+
+	verifyNone   string = "none"
+	verifySigned string = "signed"
+)
+
+type signatureError struct {
+	object string
+	err    error
+}
+
+func (se *signatureError) Error() string {
+	if se.err == nil {
+		return fmt.Sprintf("%v isn't signed", se.object)
+	}
+	return fmt.Sprintf("%v isn't signed by a trusted key (%v)", se.object, se.err)
+}
+
+func (se *signatureError) Unwrap() error {
+	return se.err
+}
+
+func getVerifyMode(info scm.ScmInfo) (string, error) {
+	mode, found := info.Arguments[verifyArg]
+	if !found {
+		return verifyNone, nil
+	}
+	switch mode {
+	case verifyNone, verifySigned:
+		return mode, nil
+	}
+	return "", &invalidArgumentError{
+		arg:   verifyArg,
+		value: mode,
+	}
+}
+
+// getTrustedKeys reads the armored keyring signatures are checked against.
+// It's parsed up front so a bad keyring isn't reported as a bad signature.
+func getTrustedKeys(component dpl.Component) (string, error) {
+	keyringPath, err := dpl.GetSingleComponentValue(component, trustedKeysKey)
+	if err != nil {
+		return "", err
+	}
+	keyringPath, err = expandHome(keyringPath)
+	if err != nil {
+		return "", err
+	}
+	keyring, err := os.ReadFile(keyringPath)
+	if err != nil {
+		return "", err
+	}
+	_, err = openpgp.ReadArmoredKeyRing(strings.NewReader(string(keyring)))
+	if err != nil {
+		return "", fmt.Errorf("can't read keyring %v: %w", keyringPath, err)
+	}
+	return string(keyring), nil
+}
+
+// refTag finds the annotated tag the configured ref names, if it names one.
+func refTag(r *gogit.Repository, info scm.ScmInfo) (*object.Tag, error) {
+	ref, found := info.Arguments[refArg]
+	if !found {
+		return nil, nil
+	}
+	for _, name := range []plumbing.ReferenceName{plumbing.ReferenceName(ref), plumbing.NewTagReferenceName(ref)} {
+		if !name.IsTag() {
+			continue
+		}
+		reference, err := r.Reference(name, true)
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tag, err := r.TagObject(reference.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			// lightweight tags have nothing to sign; the commit has to be
+			return nil, nil
+		}
+		return tag, err
+	}
+	return nil, nil
+}
+
+func checkSignature(object string, signature string, verify func(string) (*openpgp.Entity, error), keyring string) error {
+	if len(signature) == 0 {
+		return &signatureError{
+			object: object,
+		}
+	}
+	_, err := verify(keyring)
+	if err != nil {
+		return &signatureError{
+			object: object,
+			err:    err,
+		}
+	}
+	return nil
+}
+
+// verifyCheckout makes sure what's about to be checked out is signed by a
+// trusted key.  A ref naming an annotated tag needs a signed tag; anything
+// else needs a signed commit.  With a pending branch update, the commit
+// being checked is where the branch is moving to.
+func verifyCheckout(r *gogit.Repository, info scm.ScmInfo, options *gogit.CheckoutOptions, update *branchUpdate, settings cloneSettings) error {
+	if settings.verify != verifySigned {
+		return nil
+	}
+	tag, err := refTag(r, info)
+	if err != nil {
+		return err
+	}
+	if tag != nil {
+		return checkSignature(fmt.Sprintf("tag %v", tag.Name), tag.PGPSignature, tag.Verify, settings.trustedKeys)
+	}
+
+	target := options.Hash
+	if update != nil {
+		target = update.new
+	} else if options.Branch != "" {
+		branch, err := r.Reference(options.Branch, true)
+		if err != nil {
+			return err
+		}
+		target = branch.Hash()
+	}
+	commit, err := r.CommitObject(target)
+	if err != nil {
+		return err
+	}
+	return checkSignature(fmt.Sprintf("commit %v", commit.Hash), commit.PGPSignature, commit.Verify, settings.trustedKeys)
+}
@@ -0,0 +1,150 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/dev-pipeline/dpl-go/internal/test/common"
+	"github.com/dev-pipeline/dpl-go/pkg/dpl/scm"
+)
+
+func makeKey(t *testing.T) *openpgp.Entity {
+	key, err := openpgp.NewEntity("dpl", "", "dpl@example.com", &packet.Config{
+		Algorithm: packet.PubKeyAlgoEdDSA,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return key
+}
+
+func writeKeyring(t *testing.T, key *openpgp.Entity) string {
+	filename := path.Join(t.TempDir(), "trusted.asc")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.Close()
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = key.Serialize(w)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return filename
+}
+
+func runVerifiedCheckout(t *testing.T, upstream *upstreamRepo, ref string, trusted *openpgp.Entity) error {
+	handler, err := makeGit(&testcommon.ResolveComponent{
+		SourceDir: path.Join(t.TempDir(), "src"),
+		Data: map[string][]string{
+			trustedKeysKey: {writeKeyring(t, trusted)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return handler.Checkout(buildInfo(upstream.dir, map[string]string{
+		refArg:    ref,
+		verifyArg: verifySigned,
+	}))
+}
+
+func TestVerifySignedCommit(t *testing.T) {
+	key := makeKey(t)
+	upstream := makeUpstream(t)
+	upstream.signKey = key
+	upstream.commit("a.txt", "first")
+
+	err := runVerifiedCheckout(t, upstream, "main", key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestVerifyUnsignedCommit(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+
+	err := runVerifiedCheckout(t, upstream, "main", makeKey(t))
+	var sigErr *signatureError
+	if !errors.As(err, &sigErr) || sigErr.err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestVerifyUntrustedCommit(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.signKey = makeKey(t)
+	upstream.commit("a.txt", "first")
+
+	err := runVerifiedCheckout(t, upstream, "main", makeKey(t))
+	var sigErr *signatureError
+	if !errors.As(err, &sigErr) || sigErr.err == nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestVerifySignedTag(t *testing.T) {
+	key := makeKey(t)
+	upstream := makeUpstream(t)
+	first := upstream.commit("a.txt", "first")
+	upstream.signKey = key
+	upstream.tag("v1.0", first)
+
+	err := runVerifiedCheckout(t, upstream, "v1.0", key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestVerifyUnsignedTag(t *testing.T) {
+	key := makeKey(t)
+	upstream := makeUpstream(t)
+	upstream.signKey = key
+	first := upstream.commit("a.txt", "first")
+	upstream.signKey = nil
+	upstream.tag("v1.0", first)
+
+	// a signed commit doesn't vouch for an unsigned tag pointing at it
+	err := runVerifiedCheckout(t, upstream, "v1.0", key)
+	var sigErr *signatureError
+	if !errors.As(err, &sigErr) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestVerifyMissingKeyring(t *testing.T) {
+	upstream := makeUpstream(t)
+	upstream.commit("a.txt", "first")
+
+	_, err := runCheckout(t, buildInfo(upstream.dir, map[string]string{
+		verifyArg: verifySigned,
+	}))
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+}
+
+func TestVerifyInvalidMode(t *testing.T) {
+	_, err := getVerifyMode(scm.ScmInfo{
+		Arguments: map[string]string{
+			verifyArg: "maybe",
+		},
+	})
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+}